@@ -1,14 +1,10 @@
 package main
 
 import (
-	"flag"
-	"fmt"
-	"log"
-	"path"
-	"strings"
+	"os"
 
+	"github.com/antuspenskiy/automate-vhosts/pkg/cli"
 	"github.com/antuspenskiy/automate-vhosts/pkg/cmd"
-	"github.com/antuspenskiy/automate-vhosts/pkg/config"
 )
 
 var (
@@ -22,116 +18,12 @@ var (
 	BRANCH = "undefined"
 )
 
+// Compatibility alias of "av configs"
 func main() {
-	fmt.Printf("Version    : %s\n", VERSION)
-	fmt.Printf("Git Hash   : %s\n", COMMIT)
-	fmt.Printf("Build Time : %s\n", BUILDTIME)
-	fmt.Printf("Branch     : %s\n\n", BRANCH)
-
-	// Set the command line arguments
-	var (
-		refSlug = flag.String("refslug", "", "Lowercased, shortened to 63 bytes, and with everything except 0-9 and a-z replaced with -. No leading / trailing -. Use in URLs, host names and domain names.")
-	)
-
-	// Get command line arguments
-	flag.Parse()
-
-	// Load json configuration
-	conf, err := config.ReadConfig("env")
-	cmd.Check(err)
-
-	// Get server hostname
-	hostName := cmd.GetHostname()
-
-	// Variables
-	hostDir := path.Join(conf.GetString("rootdir"), *refSlug)
-
-	// Generate random port for nginx, php-fpm and pm2 configuration
-	portPhp := config.RandomTCPPort()
-	portNode := config.RandomTCPPort()
-
-	// Create nginx configuration for virtual host
-	nginxConf := path.Join(conf.GetString("nginxdir"), *refSlug+".conf")
-
-	if cmd.DirectoryExists(nginxConf) {
-		log.Printf("Nginx configuration %s exist!\n", nginxConf)
-	} else {
-		nginxData := config.NginxTemplate{
-			ServerName:   fmt.Sprintf("%s.%s", *refSlug, conf.GetString("subdomain")),
-			PortPhp:      portPhp,
-			PortNode:     portNode,
-			RefSlug:      *refSlug,
-			TemplatePath: conf.GetString("server.nginxtmpl"),
-		}
-
-		nginxData.Write(nginxConf)
-		log.Printf("Nginx configuration %s created\n", nginxConf)
-	}
-
-	// Create php-fpm configuration
-	fpmConf := path.Join(conf.GetString("fpmdir"), *refSlug+".conf")
-
-	if cmd.DirectoryExists(fpmConf) {
-		log.Printf("Php-fpm configuration %s exist!\n", fpmConf)
-	} else {
-		m := make(map[string]string)
-		m["listen"] = fmt.Sprintf("127.0.0.1:%d\n", portPhp)
-		m["user"] = "user"
-		m["pm"] = "static"
-		m["pm.max_children"] = "2"
-		m["pm.max_requests"] = "500"
-		m["request_terminate_timeout"] = "65m"
-		m["php_admin_value[max_execution_time]"] = "300"
-		m["php_admin_value[sendmail_path]"] = "false"
-
-		if strings.Contains(hostName, "intranet") {
-			m["php_admin_value[mbstring.func_overload]"] = "4"
-		}
-
-		fpm := config.FpmConfig{
-			Section: *refSlug,
-			Params:  m,
-		}
-
-		fpm.Write(fpmConf)
-		log.Printf("Php-fpm configuration %s created\n", fpmConf)
-		cmd.RunCommand("bash", "-c", "systemctl restart nginx php-fpm")
-	}
-
-	// Create pm2 configuration for test-intranet
-	pm2Conf := path.Join(conf.GetString("server.pm2"), *refSlug+".json")
-
-	if strings.Contains(hostName, "intranet") {
-		if cmd.DirectoryExists(pm2Conf) {
-			log.Printf("Pm2 configuration %s exist!\n", pm2Conf)
-
-			// Don't reload process, delete it and start again
-			cmd.RunCommand("bash", "-c", fmt.Sprintf("sudo -u user pm2 describe %s", *refSlug))
-			cmd.RunCommand("bash", "-c", fmt.Sprintf("sudo -u user pm2 delete -s %s || :", *refSlug))
-			cmd.RunCommand("bash", "-c", fmt.Sprintf("sudo -u user pm2 start %s", pm2Conf))
-		} else {
-			pm2Data := config.PM2Config{
-				Apps: []config.App{
-					{
-						ExecMode: "fork_mode",
-						Script:   "tools/run.js",
-						Args:     []string{"start"},
-						Name:     *refSlug,
-						Cwd:      hostDir,
-						Env: config.Env{
-							Port:    portNode,
-							NodeEnv: "development",
-						},
-						ErrorFile: fmt.Sprintf("log/%s.err.log", *refSlug),
-						OutFile:   fmt.Sprintf("log/%s.out.log", *refSlug),
-					},
-				},
-			}
-
-			pm2Data.Write(pm2Conf)
-			log.Printf("Pm2 configuration created:\n%s", config.PrettyJSON(pm2Data))
-			// Start pm2 process
-			cmd.RunCommand("bash", "-c", fmt.Sprintf("sudo -u user pm2 start %s", pm2Conf))
-		}
+	build := cli.BuildInfo{Version: VERSION, Commit: COMMIT, BuildTime: BUILDTIME, Branch: BRANCH}
+	err := cli.Run(build, "configs", os.Args[1:])
+	if err == cli.ErrUsage {
+		os.Exit(2)
 	}
+	cmd.Check(err)
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/cli"
+	"github.com/antuspenskiy/automate-vhosts/pkg/cmd"
+)
+
+var (
+	// VERSION used to show version of CLI
+	VERSION = "undefined"
+	// BUILDTIME used to show buildtime of CLI
+	BUILDTIME = "undefined"
+	// COMMIT used to show commit when CLI compiled
+	COMMIT = "undefined"
+	// BRANCH used to show branchname when CLI compiled
+	BRANCH = "undefined"
+)
+
+func main() {
+	build := cli.BuildInfo{Version: VERSION, Commit: COMMIT, BuildTime: BUILDTIME, Branch: BRANCH}
+	err := cli.Main(build, os.Args[1:])
+	if err == cli.ErrUsage {
+		os.Exit(2)
+	}
+	cmd.Check(err)
+}
@@ -0,0 +1,245 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Format of archive, detected by magic bytes
+type Format string
+
+// Supported archive formats
+const (
+	FormatGzip  Format = "gzip"
+	FormatZstd  Format = "zstd"
+	FormatXz    Format = "xz"
+	FormatZip   Format = "zip"
+	FormatPlain Format = "plain"
+)
+
+var (
+	magicGzip = []byte{0x1f, 0x8b}
+	magicZstd = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicXz   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	magicZip  = []byte{'P', 'K', 0x03, 0x04}
+)
+
+// EntryType is a type of archive entry
+type EntryType int
+
+// Types of archive entries
+const (
+	TypeFile EntryType = iota
+	TypeDir
+	TypeSymlink
+	TypeHardlink
+	TypeOther
+)
+
+// Entry of archive, compressed single file (.sql.gz) is an archive with one
+// entry named after archive file without compression extension
+type Entry struct {
+	Name     string
+	Type     EntryType
+	Mode     os.FileMode
+	Linkname string
+	Size     int64
+}
+
+// WalkFunc is called for every entry of archive, r is a content of file
+// entry and it is valid only until WalkFunc returns
+type WalkFunc func(e *Entry, r io.Reader) error
+
+// dumpExtensions are extensions of files which Walk reads as dumps
+var dumpExtensions = []string{
+	".sql", ".sql.gz", ".sql.zst", ".sql.xz",
+	".tar", ".tar.gz", ".tgz", ".tar.zst", ".tar.xz", ".zip",
+}
+
+// IsDump returns true if file name has extension of dump or archive which
+// Walk reads, format itself is detected by magic bytes
+func IsDump(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range dumpExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectFormat returns format of archive by magic bytes
+func DetectFormat(head []byte) Format {
+	switch {
+	case bytes.HasPrefix(head, magicGzip):
+		return FormatGzip
+	case bytes.HasPrefix(head, magicZstd):
+		return FormatZstd
+	case bytes.HasPrefix(head, magicXz):
+		return FormatXz
+	case bytes.HasPrefix(head, magicZip):
+		return FormatZip
+	}
+	return FormatPlain
+}
+
+// Walk call fn for every entry of archive, content is streamed from archive
+// without extracting it to disk. Supported are .tar, .tar.gz, .tar.zst,
+// .tar.xz, .zip and single compressed files like .sql.gz.
+func Walk(path string, fn WalkFunc) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReaderSize(f, 64*1024)
+	head, err := br.Peek(len(magicXz))
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	name := streamName(path)
+	switch DetectFormat(head) {
+	case FormatZip:
+		return walkZip(path, fn)
+	case FormatGzip:
+		gzr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gzr.Close()
+		return walkStream(gzr, name, fn)
+	case FormatZstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		return walkStream(zr, name, fn)
+	case FormatXz:
+		xr, err := xz.NewReader(br)
+		if err != nil {
+			return err
+		}
+		return walkStream(xr, name, fn)
+	}
+	return walkStream(br, name, fn)
+}
+
+// streamName returns entry name for single compressed file, dump.sql.gz becomes dump.sql
+func streamName(path string) string {
+	name := filepath.Base(path)
+	switch filepath.Ext(name) {
+	case ".gz", ".zst", ".xz":
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	if filepath.Ext(name) != ".sql" {
+		name += ".sql"
+	}
+	return name
+}
+
+// walkStream walk tar archive or single file from decompressed stream
+func walkStream(r io.Reader, name string, fn WalkFunc) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	head, err := br.Peek(262)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if len(head) == 262 && string(head[257:262]) == "ustar" {
+		return walkTar(tar.NewReader(br), fn)
+	}
+	return fn(&Entry{Name: name, Type: TypeFile, Mode: 0644, Size: -1}, br)
+}
+
+func walkTar(tr *tar.Reader, fn WalkFunc) error {
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		e := &Entry{
+			Name:     hdr.Name,
+			Mode:     os.FileMode(hdr.Mode).Perm(),
+			Linkname: hdr.Linkname,
+			Size:     hdr.Size,
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			e.Type = TypeFile
+		case tar.TypeDir:
+			e.Type = TypeDir
+		case tar.TypeSymlink:
+			e.Type = TypeSymlink
+		case tar.TypeLink:
+			e.Type = TypeHardlink
+		default:
+			e.Type = TypeOther
+		}
+		if err = fn(e, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func walkZip(path string, fn WalkFunc) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		mode := zf.Mode()
+		e := &Entry{
+			Name: zf.Name,
+			Mode: mode.Perm(),
+			Size: int64(zf.UncompressedSize64),
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		switch {
+		case mode.IsDir():
+			e.Type = TypeDir
+		case mode&os.ModeSymlink != 0:
+			// Symlink target is stored as file content
+			e.Type = TypeSymlink
+			target, err := ioutil.ReadAll(io.LimitReader(rc, 4096))
+			if err != nil {
+				rc.Close()
+				return err
+			}
+			e.Linkname = string(target)
+		case mode.IsRegular():
+			e.Type = TypeFile
+		default:
+			e.Type = TypeOther
+		}
+
+		err = fn(e, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
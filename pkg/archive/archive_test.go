@@ -0,0 +1,348 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// testEntry is an entry of archive written by writeTar and writeZip
+type testEntry struct {
+	name     string
+	typ      EntryType
+	linkname string
+	content  string
+}
+
+// compressor wraps w with compression of archive file
+type compressor func(w io.Writer) (io.WriteCloser, error)
+
+var (
+	noCompression = func(w io.Writer) (io.WriteCloser, error) { return nopCloser{w}, nil }
+	gzipWriter    = func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }
+	zstdWriter    = func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) }
+	xzWriter      = func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) }
+)
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// writeTar write tar archive of entries to path, compressed by c
+func writeTar(t *testing.T, path string, c compressor, entries ...testEntry) string {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cw, err := c(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(cw)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Linkname: e.linkname, Size: int64(len(e.content))}
+		switch e.typ {
+		case TypeFile:
+			hdr.Typeflag = tar.TypeReg
+		case TypeDir:
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		case TypeSymlink:
+			hdr.Typeflag = tar.TypeSymlink
+		case TypeHardlink:
+			hdr.Typeflag = tar.TypeLink
+		}
+		if e.typ != TypeFile {
+			hdr.Size = 0
+		}
+		if err = tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if e.typ == TypeFile {
+			if _, err = io.WriteString(tw, e.content); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeZip write zip archive of file and symlink entries to path
+func writeZip(t *testing.T, path string, entries ...testEntry) string {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		content := e.content
+		switch e.typ {
+		case TypeSymlink:
+			hdr.SetMode(os.ModeSymlink | 0777)
+			content = e.linkname
+		case TypeDir:
+			hdr.SetMode(os.ModeDir | 0755)
+		default:
+			hdr.SetMode(0644)
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = io.WriteString(w, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestIsDump(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"dump_20260101.000000.tar.gz", true},
+		{"portal.sql", true},
+		{"portal.sql.gz", true},
+		{"portal.sql.zst", true},
+		{"portal.SQL.XZ", true},
+		{"backup.tgz", true},
+		{"backup.tar.zst", true},
+		{"backup.zip", true},
+		{"README.md", false},
+		{"portal.sql.gz.md5", false},
+		{"backup.tar.gz.part", false},
+		{"upload.gz", false},
+		{"sql", false},
+	}
+	for _, tt := range tests {
+		if got := IsDump(tt.name); got != tt.want {
+			t.Errorf("IsDump(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWalk(t *testing.T) {
+	dir := t.TempDir()
+	dumps := map[string]string{
+		"portal.sql": "SELECT 1;\n",
+		"books.sql":  "SELECT 2;\n",
+	}
+	entries := []testEntry{
+		{name: "dump/", typ: TypeDir},
+		{name: "dump/portal.sql", typ: TypeFile, content: dumps["portal.sql"]},
+		{name: "dump/books.sql", typ: TypeFile, content: dumps["books.sql"]},
+	}
+	inDir := map[string]string{
+		"dump/portal.sql": dumps["portal.sql"],
+		"dump/books.sql":  dumps["books.sql"],
+	}
+
+	// Tar archive of dumps, as av-dump writes it
+	tarFile := filepath.Join(dir, "dump_20260101.000000.tar.gz")
+	tw, err := NewTarGzWriter(tarFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"portal.sql", "books.sql"} {
+		content := dumps[name]
+		if err = tw.WriteEntry(name, func(w io.Writer) error {
+			_, err := io.WriteString(w, content)
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Single compressed dumps
+	singleFile := func(name string, c compressor) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		cw, err := c(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(cw, dumps["portal.sql"])
+		if err = cw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// Plain dump
+	plainFile := filepath.Join(dir, "books.sql")
+	if err = ioutil.WriteFile(plainFile, []byte(dumps["books.sql"]), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	portal := map[string]string{"portal.sql": dumps["portal.sql"]}
+	tests := []struct {
+		path string
+		want map[string]string
+	}{
+		{tarFile, dumps},
+		{writeTar(t, filepath.Join(dir, "dump.tar"), noCompression, entries...), inDir},
+		{writeTar(t, filepath.Join(dir, "dump.tar.zst"), zstdWriter, entries...), inDir},
+		{writeTar(t, filepath.Join(dir, "dump.tar.xz"), xzWriter, entries...), inDir},
+		// Extension doesn't matter, format is detected by magic bytes
+		{writeTar(t, filepath.Join(dir, "dump.tgz"), gzipWriter, entries...), inDir},
+		{writeZip(t, filepath.Join(dir, "dump.zip"), entries...), inDir},
+		{singleFile("portal.sql.gz", gzipWriter), portal},
+		{singleFile("portal.sql.zst", zstdWriter), portal},
+		{singleFile("portal.sql.xz", xzWriter), portal},
+		{plainFile, map[string]string{"books.sql": dumps["books.sql"]}},
+	}
+	for _, tt := range tests {
+		got := make(map[string]string)
+		err := Walk(tt.path, func(e *Entry, r io.Reader) error {
+			if e.Type != TypeFile {
+				return nil
+			}
+			data, err := ioutil.ReadAll(r)
+			got[e.Name] = string(data)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Walk(%s): %v", tt.path, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Walk(%s) = %q, want %q", filepath.Base(tt.path), got, tt.want)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "dst")
+	entries := []testEntry{
+		{name: "dump/", typ: TypeDir},
+		{name: "dump/schema.sql", typ: TypeFile, content: "CREATE TABLE a (id int);\n"},
+		{name: "dump/data.sql", typ: TypeFile, content: "INSERT INTO a VALUES (1);\n"},
+		{name: "latest", typ: TypeSymlink, linkname: "dump/data.sql"},
+	}
+
+	for _, path := range []string{
+		writeTar(t, filepath.Join(dir, "dump.tar.gz"), gzipWriter, entries...),
+		writeZip(t, filepath.Join(dir, "dump.zip"), entries...),
+	} {
+		os.RemoveAll(dst)
+		files, err := Extract(path, dst)
+		if err != nil {
+			t.Fatalf("Extract(%s): %v", filepath.Base(path), err)
+		}
+		sort.Strings(files)
+		want := []string{filepath.Join(dst, "dump", "data.sql"), filepath.Join(dst, "dump", "schema.sql")}
+		if !reflect.DeepEqual(files, want) {
+			t.Errorf("Extract(%s) = %q, want %q", filepath.Base(path), files, want)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dst, "latest"))
+		if err != nil || string(data) != "INSERT INTO a VALUES (1);\n" {
+			t.Errorf("symlink of %s = %q, %v", filepath.Base(path), data, err)
+		}
+	}
+}
+
+func TestExtractUnsafe(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testEntry
+	}{
+		{
+			name:    "path traversal",
+			entries: []testEntry{{name: "../x", typ: TypeFile, content: "x"}},
+		},
+		{
+			name:    "nested path traversal",
+			entries: []testEntry{{name: "dump/../../x", typ: TypeFile, content: "x"}},
+		},
+		{
+			name:    "absolute path",
+			entries: []testEntry{{name: "/etc/x", typ: TypeFile, content: "x"}},
+		},
+		{
+			name:    "symlink outside",
+			entries: []testEntry{{name: "link", typ: TypeSymlink, linkname: "../outside/x"}},
+		},
+		{
+			name:    "absolute symlink",
+			entries: []testEntry{{name: "link", typ: TypeSymlink, linkname: "/etc/passwd"}},
+		},
+		{
+			name: "file through symlink",
+			entries: []testEntry{
+				{name: "here", typ: TypeSymlink, linkname: "."},
+				{name: "up", typ: TypeSymlink, linkname: "here/.."},
+				{name: "up/x", typ: TypeFile, content: "x"},
+			},
+		},
+		{
+			name:    "hard link outside",
+			entries: []testEntry{{name: "link", typ: TypeHardlink, linkname: "../outside/x"}},
+		},
+		{
+			name:    "absolute hard link",
+			entries: []testEntry{{name: "link", typ: TypeHardlink, linkname: "/etc/passwd"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			outside := filepath.Join(dir, "outside")
+			if err := os.Mkdir(outside, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(outside, "x"), []byte("secret"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			path := writeTar(t, filepath.Join(dir, "dump.tar"), noCompression, tt.entries...)
+			_, err := Extract(path, filepath.Join(dir, "dst"))
+			var unsafe *UnsafeEntryError
+			if !errors.As(err, &unsafe) {
+				t.Errorf("Extract = %v, want UnsafeEntryError", err)
+			}
+
+			// Nothing is written outside of destination
+			for _, name := range []string{filepath.Join(dir, "x"), filepath.Join(outside, "x")} {
+				data, err := ioutil.ReadFile(name)
+				if name == filepath.Join(dir, "x") && !os.IsNotExist(err) {
+					t.Errorf("%s is written outside of destination", name)
+				}
+				if name == filepath.Join(outside, "x") && string(data) != "secret" {
+					t.Errorf("%s is overwritten: %q", name, data)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// UnsafeEntryError returned when archive entry would be written outside of
+// destination directory
+type UnsafeEntryError struct {
+	Name   string
+	Reason string
+}
+
+func (e *UnsafeEntryError) Error() string {
+	return fmt.Sprintf("unsafe archive entry %s: %s", e.Name, e.Reason)
+}
+
+// Extract extract archive of any supported format to destination directory and
+// returns extracted files. Entries with path traversal, absolute paths,
+// symlinks pointing outside of dst and hard links are rejected.
+func Extract(path string, dst string) ([]string, error) {
+	dst, err := filepath.Abs(dst)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(dst, 0750); err != nil {
+		return nil, err
+	}
+	// Destination itself can be a symlink, compare with resolved path
+	if dst, err = filepath.EvalSymlinks(dst); err != nil {
+		return nil, err
+	}
+
+	var files []string
+	err = Walk(path, func(e *Entry, r io.Reader) error {
+		target, err := entryPath(dst, e.Name)
+		if err != nil {
+			return err
+		}
+
+		switch e.Type {
+		case TypeDir:
+			if err = mkdirInside(dst, target, e.Name); err != nil {
+				return err
+			}
+			return nil
+		case TypeFile:
+			if err = mkdirInside(dst, filepath.Dir(target), e.Name); err != nil {
+				return err
+			}
+			if err = writeFile(target, e, r); err != nil {
+				return err
+			}
+			files = append(files, target)
+			log.Printf("File %s extracted", target)
+			return nil
+		case TypeSymlink:
+			if err = mkdirInside(dst, filepath.Dir(target), e.Name); err != nil {
+				return err
+			}
+			if filepath.IsAbs(e.Linkname) {
+				return &UnsafeEntryError{Name: e.Name, Reason: "absolute symlink target " + e.Linkname}
+			}
+			parent, err := filepath.EvalSymlinks(filepath.Dir(target))
+			if err != nil {
+				return err
+			}
+			if !inside(dst, filepath.Join(parent, e.Linkname)) {
+				return &UnsafeEntryError{Name: e.Name, Reason: "symlink target outside of destination " + e.Linkname}
+			}
+			if err = removeExisting(target, e.Name); err != nil {
+				return err
+			}
+			if err = os.Symlink(e.Linkname, target); err != nil {
+				return err
+			}
+			// Target can escape through symlinks extracted before, like l -> . and l2 -> l/..
+			if resolved, err := filepath.EvalSymlinks(target); err == nil && !inside(dst, resolved) {
+				os.Remove(target)
+				return &UnsafeEntryError{Name: e.Name, Reason: "symlink resolves outside of destination"}
+			}
+			return nil
+		case TypeHardlink:
+			return &UnsafeEntryError{Name: e.Name, Reason: "hard links are not supported"}
+		}
+		log.Printf("Skip archive entry %s of unsupported type", e.Name)
+		return nil
+	})
+	return files, err
+}
+
+// entryPath returns path of entry inside dst, rejects absolute and traversal paths
+func entryPath(dst, name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" {
+		return "", &UnsafeEntryError{Name: name, Reason: "absolute path"}
+	}
+	target := filepath.Join(dst, clean)
+	if !inside(dst, target) || target == dst {
+		return "", &UnsafeEntryError{Name: name, Reason: "path outside of destination"}
+	}
+	return target, nil
+}
+
+// inside returns true if path is inside of dir
+func inside(dir, path string) bool {
+	rel, err := filepath.Rel(dir, filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// mkdirInside create directory and checks that symlinks extracted before
+// don't redirect it outside of dst
+func mkdirInside(dst, dir, name string) error {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if !inside(dst, resolved) {
+		return &UnsafeEntryError{Name: name, Reason: "directory resolves outside of destination through symlink"}
+	}
+	return nil
+}
+
+// removeExisting remove file which is replaced by entry, directories are kept
+func removeExisting(target, name string) error {
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return &UnsafeEntryError{Name: name, Reason: "directory exists at entry path"}
+	}
+	return os.Remove(target)
+}
+
+// writeFile write entry content, never follows symlink at target
+func writeFile(target string, e *Entry, r io.Reader) error {
+	if err := removeExisting(target, e.Name); err != nil {
+		return err
+	}
+	mode := e.Mode.Perm() &^ 0022
+	if mode == 0 {
+		mode = 0644
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
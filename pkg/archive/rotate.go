@@ -0,0 +1,51 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/plan"
+)
+
+// Retention policy for dumps, zero value of a field disables it
+type Retention struct {
+	KeepDays  int
+	KeepCount int
+}
+
+// Rotate delete files in dir matching pattern which are older than KeepDays
+// or beyond KeepCount newest ones. Names must sort by date, like
+// dump_20060102.150405.tar.gz. Returns deleted files.
+func Rotate(dir string, pattern string, r Retention) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return nil, err
+	}
+	// Newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+
+	deadline := time.Now().AddDate(0, 0, -r.KeepDays)
+	var deleted []string
+	for i, file := range files {
+		expired := r.KeepCount > 0 && i >= r.KeepCount
+		if !expired && r.KeepDays > 0 {
+			info, err := os.Stat(file)
+			if err != nil {
+				return deleted, err
+			}
+			expired = info.ModTime().Before(deadline)
+		}
+		if !expired {
+			continue
+		}
+		if !plan.Record(plan.Remove, "%s", file) {
+			if err = os.Remove(file); err != nil {
+				return deleted, err
+			}
+		}
+		deleted = append(deleted, file)
+	}
+	return deleted, nil
+}
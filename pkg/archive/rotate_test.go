@@ -0,0 +1,97 @@
+package archive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestRotate(t *testing.T) {
+	// Dumps of the last five days, one per day, the newest one is an hour old
+	files := []string{
+		"dump_20260101.000000.tar.gz",
+		"dump_20260102.000000.tar.gz",
+		"dump_20260103.000000.tar.gz",
+		"dump_20260104.000000.tar.gz",
+		"dump_20260105.000000.tar.gz",
+	}
+	tests := []struct {
+		name    string
+		pattern string
+		r       Retention
+		deleted []string
+	}{
+		{
+			name:    "disabled",
+			pattern: "dump_*.tar.gz",
+			r:       Retention{},
+			deleted: nil,
+		},
+		{
+			name:    "keep count",
+			pattern: "dump_*.tar.gz",
+			r:       Retention{KeepCount: 2},
+			deleted: files[:3],
+		},
+		{
+			name:    "keep days",
+			pattern: "dump_*.tar.gz",
+			r:       Retention{KeepDays: 2},
+			deleted: files[:3],
+		},
+		{
+			name:    "keep count and days",
+			pattern: "dump_*.tar.gz",
+			r:       Retention{KeepDays: 3, KeepCount: 1},
+			deleted: files[:4],
+		},
+		{
+			name:    "other files are kept",
+			pattern: "other_*.tar.gz",
+			r:       Retention{KeepCount: 1},
+			deleted: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			now := time.Now()
+			for i, name := range files {
+				path := filepath.Join(dir, name)
+				if err := ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+					t.Fatal(err)
+				}
+				mtime := now.AddDate(0, 0, i-len(files)+1).Add(-time.Hour)
+				if err := os.Chtimes(path, mtime, mtime); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			deleted, err := Rotate(dir, tt.pattern, tt.r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []string
+			for _, name := range tt.deleted {
+				want = append(want, filepath.Join(dir, name))
+			}
+			sort.Strings(deleted)
+			if !reflect.DeepEqual(deleted, want) {
+				t.Errorf("Rotate(%+v) deleted %q, want %q", tt.r, deleted, want)
+			}
+			for _, path := range deleted {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("%s is not deleted: %v", path, err)
+				}
+			}
+			left, _ := filepath.Glob(filepath.Join(dir, "*"))
+			if len(left) != len(files)-len(deleted) {
+				t.Errorf("%d files left, want %d", len(left), len(files)-len(deleted))
+			}
+		})
+	}
+}
@@ -4,48 +4,97 @@ import (
 	"archive/tar"
 	"compress/gzip"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"time"
 )
 
-// ExtractTarGz extracting *.tar.gz archives to destination folder
-func ExtractTarGz(tarFile string, tarExtractDst string) {
-	f, err := os.Open(tarFile)
-	if err != nil {
-		log.Fatal("Open file failed")
-	}
-	defer f.Close()
+// TarGzWriter write *.tar.gz archive with entries produced by writer functions
+type TarGzWriter struct {
+	f   *os.File
+	gzw *gzip.Writer
+	tw  *tar.Writer
+}
 
-	gzf, err := gzip.NewReader(f)
+// NewTarGzWriter create *.tar.gz archive
+func NewTarGzWriter(tarFile string) (*TarGzWriter, error) {
+	f, err := os.Create(tarFile)
 	if err != nil {
-		log.Fatal("Couldn't create gzip reader")
+		return nil, err
 	}
-	defer f.Close()
-
-	tarReader := tar.NewReader(gzf)
+	gzw := gzip.NewWriter(f)
+	return &TarGzWriter{f: f, gzw: gzw, tw: tar.NewWriter(gzw)}, nil
+}
 
-	for true {
+// countWriter counts bytes written through it
+type countWriter struct {
+	w io.Writer
+	n int64
+}
 
-		_, err := tarReader.Next()
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
 
-		if err == io.EOF {
-			break
-		}
+// WriteEntry add entry with content written by fn. Tar header needs entry
+// size before content, so content is spooled gzip compressed to a temporary
+// file next to archive and then streamed into the archive.
+func (t *TarGzWriter) WriteEntry(name string, fn func(w io.Writer) error) error {
+	spool, err := ioutil.TempFile(filepath.Dir(t.f.Name()), ".spool-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
 
-		if err != nil {
-			log.Fatalf("Next() failed: %s", err.Error())
-		}
+	sgz, err := gzip.NewWriterLevel(spool, gzip.BestSpeed)
+	if err != nil {
+		return err
+	}
+	counter := &countWriter{w: sgz}
+	if err = fn(counter); err != nil {
+		return err
+	}
+	if err = sgz.Close(); err != nil {
+		return err
+	}
+	if _, err = spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
 
-		outFile, err := os.Create(tarExtractDst)
-		if err != nil {
-			log.Fatalf("Create() failed: %s", err.Error())
-		}
-		log.Printf("Create file %s", tarExtractDst)
-		defer outFile.Close()
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    counter.n,
+		ModTime: time.Now(),
+	}
+	if err = t.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	sr, err := gzip.NewReader(spool)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(t.tw, sr); err != nil {
+		return err
+	}
+	log.Printf("Archive entry %s added, %d bytes", name, counter.n)
+	return nil
+}
 
-		if _, err := io.Copy(outFile, tarReader); err != nil {
-			log.Fatalf("Copy() failed: %s", err.Error())
-		}
-		log.Println("File extracted succefully")
+// Close finish archive
+func (t *TarGzWriter) Close() error {
+	if err := t.tw.Close(); err != nil {
+		t.f.Close()
+		return err
+	}
+	if err := t.gzw.Close(); err != nil {
+		t.f.Close()
+		return err
 	}
+	return t.f.Close()
 }
@@ -0,0 +1,231 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/cmd"
+	"github.com/antuspenskiy/automate-vhosts/pkg/config"
+	"github.com/antuspenskiy/automate-vhosts/pkg/plan"
+	"github.com/spf13/viper"
+
+	// MySQL driver for database/sql
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// Output formats
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// ErrUsage is returned when command line arguments are wrong, usage is printed
+var ErrUsage = errors.New("wrong usage")
+
+// BuildInfo is set by -ldflags when CLI is compiled
+type BuildInfo struct {
+	Version   string
+	Commit    string
+	BuildTime string
+	Branch    string
+}
+
+// Print write version banner
+func (b BuildInfo) Print(w io.Writer) {
+	fmt.Fprintf(w, "Version    : %s\n", b.Version)
+	fmt.Fprintf(w, "Git Hash   : %s\n", b.Commit)
+	fmt.Fprintf(w, "Build Time : %s\n", b.BuildTime)
+	fmt.Fprintf(w, "Branch     : %s\n\n", b.Branch)
+}
+
+// Globals are flags shared by all commands, they are accepted before and
+// after command name
+type Globals struct {
+	ConfigPath string
+	Profile    string
+	Output     string
+	DryRun     bool
+
+	MySQLUser     string
+	MySQLPassword string
+	MySQLHostname string
+	MySQLPort     string
+	MySQLDatabase string
+
+	build BuildInfo
+}
+
+// Register add global flags to flag set, current values are defaults, so
+// flags parsed before command name are kept
+func (g *Globals) Register(fs *flag.FlagSet) {
+	fs.StringVar(&g.ConfigPath, "config", g.ConfigPath, "Path of env.json, /opt/scripts/config/env.json if empty.")
+	fs.StringVar(&g.Profile, "profile", g.Profile, "Name of project profile from env.json, selected by server hostname if empty.")
+	fs.StringVar(&g.Output, "output", g.Output, "Output format: text or json.")
+	fs.BoolVar(&g.DryRun, "dry-run", g.DryRun, "Print plan of commands, SQL queries and file changes without executing them.")
+	fs.StringVar(&g.MySQLUser, "user", g.MySQLUser, "Name of your database user.")
+	fs.StringVar(&g.MySQLPassword, "password", g.MySQLPassword, "Name of your database user password.")
+	fs.StringVar(&g.MySQLHostname, "hostname", g.MySQLHostname, "Name of your database hostname.")
+	fs.StringVar(&g.MySQLPort, "port", g.MySQLPort, "Name of your database port.")
+	fs.StringVar(&g.MySQLDatabase, "database", g.MySQLDatabase, "Name of your database.")
+}
+
+// JSON returns true if output format is JSON
+func (g *Globals) JSON() bool {
+	return g.Output == OutputJSON
+}
+
+// Config read env.json from -config path or from default directory
+func (g *Globals) Config() (*viper.Viper, error) {
+	var conf *viper.Viper
+	var err error
+	if g.ConfigPath != "" {
+		conf, err = config.ReadConfigFile(g.ConfigPath)
+	} else {
+		conf, err = config.ReadConfig("env")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Services are controlled by manager of env.json
+	m, err := config.ServiceManagerFromConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	cmd.SetServiceManager(m)
+	return conf, nil
+}
+
+// SelectProfile returns profile set by -profile flag, by env.json or by server hostname
+func (g *Globals) SelectProfile(conf *viper.Viper) (*config.Profile, error) {
+	profile, err := config.SelectProfile(conf, g.Profile, cmd.GetHostname())
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Profile: %s\n", profile.Name)
+	return profile, nil
+}
+
+// OpenDB connect to MySQL by global flags and check connection
+func (g *Globals) OpenDB() (*sql.DB, error) {
+	// [user[:pass]@][protocol[(addr)]]/dbname[?p1=v1&...]
+	mysqlInfo := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s",
+		g.MySQLUser, g.MySQLPassword, g.MySQLHostname, g.MySQLPort, g.MySQLDatabase)
+
+	conn, err := sql.Open("mysql", mysqlInfo)
+	if err != nil {
+		return nil, err
+	}
+	// make sure connection is available
+	if err = conn.Ping(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	log.Println("Successfully connected to MySQL!")
+	return conn, nil
+}
+
+// Command is a subcommand of av
+type Command struct {
+	Name  string
+	Usage string
+	// Flags register command flags, parsed values are used by Run
+	Flags func(fs *flag.FlagSet)
+	Run   func(ctx context.Context, g *Globals, args []string) error
+}
+
+var commands = make(map[string]*Command)
+
+// register add command, called from init of command files
+func register(c *Command) {
+	if _, ok := commands[c.Name]; ok {
+		panic("cli: command registered twice: " + c.Name)
+	}
+	commands[c.Name] = c
+}
+
+// Main parse global flags and run command named by the first argument:
+// av [global flags] <command> [flags]
+func Main(build BuildInfo, args []string) error {
+	g := &Globals{Output: OutputText, MySQLHostname: "localhost", MySQLPort: "3306", build: build}
+	fs := flag.NewFlagSet("av", flag.ContinueOnError)
+	g.Register(fs)
+	fs.Usage = func() { usage(fs) }
+	if err := fs.Parse(args); err != nil {
+		return ErrUsage
+	}
+	if fs.NArg() == 0 {
+		usage(fs)
+		return ErrUsage
+	}
+	return run(g, fs.Arg(0), fs.Args()[1:])
+}
+
+// Run run command by name with its arguments, used by compatibility binaries
+// av-env, av-configs, av-import, av-remove and av-dump
+func Run(build BuildInfo, name string, args []string) error {
+	g := &Globals{Output: OutputText, MySQLHostname: "localhost", MySQLPort: "3306", build: build}
+	return run(g, name, args)
+}
+
+func run(g *Globals, name string, args []string) error {
+	if name == "version" {
+		g.build.Print(os.Stdout)
+		return nil
+	}
+	c, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %s, run av -h for list of commands", name)
+	}
+
+	fs := flag.NewFlagSet("av "+name, flag.ContinueOnError)
+	g.Register(fs)
+	if c.Flags != nil {
+		c.Flags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: av %s\n\n", c.Usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return ErrUsage
+	}
+	if g.Output != OutputText && g.Output != OutputJSON {
+		return fmt.Errorf("unknown output format %s", g.Output)
+	}
+
+	// In dry-run mode side effects are only added to plan, which is printed on exit
+	defer plan.Start(g.DryRun, g.JSON())()
+
+	if !g.JSON() {
+		g.build.Print(os.Stdout)
+	}
+	// Running commands are killed on interrupt or when CI job is cancelled
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return c.Run(ctx, g, fs.Args())
+}
+
+func usage(fs *flag.FlagSet) {
+	w := fs.Output()
+	fmt.Fprintf(w, "Usage: av [global flags] <command> [flags]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  av %s\n", commands[name].Usage)
+	}
+	fmt.Fprintf(w, "  av version\n\nGlobal flags:\n")
+	fs.PrintDefaults()
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"context"
+	"flag"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/vhost"
+)
+
+func init() {
+	var refSlug string
+	register(&Command{
+		Name:  "configs",
+		Usage: "configs -refslug <refslug>",
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&refSlug, "refslug", "", refSlugUsage)
+		},
+		Run: func(ctx context.Context, g *Globals, args []string) error {
+			conf, err := g.Config()
+			if err != nil {
+				return err
+			}
+			profile, err := g.SelectProfile(conf)
+			if err != nil {
+				return err
+			}
+
+			// Create nginx, php-fpm and pm2 configuration, start pm2 process
+			_, err = vhost.ConfigureServices(ctx, vhost.Options{
+				RefSlug: refSlug,
+				Profile: profile,
+				Conf:    conf,
+			})
+			return err
+		},
+	})
+}
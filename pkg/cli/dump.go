@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/archive"
+	"github.com/antuspenskiy/automate-vhosts/pkg/cmd"
+	"github.com/antuspenskiy/automate-vhosts/pkg/db"
+	"github.com/antuspenskiy/automate-vhosts/pkg/plan"
+)
+
+func init() {
+	var (
+		fs                                  *flag.FlagSet
+		allDatabases                        bool
+		tables, excludeTables, noDataTables string
+		keepDays, keepCount                 int
+	)
+	register(&Command{
+		Name:  "dump",
+		Usage: "dump -user <user> -password <password> (-database <name> | -all)",
+		Flags: func(f *flag.FlagSet) {
+			fs = f
+			fs.BoolVar(&allDatabases, "all", false, "If set dump all MySQL databases.")
+			fs.StringVar(&tables, "tables", "", "Comma separated tables to dump, all if empty. Default is dump.tables of env.json.")
+			fs.StringVar(&excludeTables, "exclude-tables", "", "Comma separated tables to skip. Default is dump.exclude-tables of env.json.")
+			fs.StringVar(&noDataTables, "nodata-tables", "", "Comma separated tables to dump without rows. Default is dump.nodata-tables of env.json.")
+			fs.IntVar(&keepDays, "keep-days", 0, "Delete dumps older than N days, 0 disables. Default is dump.keep-days of env.json.")
+			fs.IntVar(&keepCount, "keep-count", 0, "Keep only N newest dumps, 0 disables. Default is dump.keep-count of env.json.")
+		},
+		Run: func(ctx context.Context, g *Globals, args []string) error {
+			if g.MySQLDatabase == "" && !allDatabases {
+				return errors.New("set -database or -all")
+			}
+			conf, err := g.Config()
+			if err != nil {
+				return err
+			}
+
+			// Flags which are not set take values of dump section of env.json
+			set := make(map[string]bool)
+			fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+			if !set["tables"] {
+				tables = strings.Join(conf.GetStringSlice("dump.tables"), ",")
+			}
+			if !set["exclude-tables"] {
+				excludeTables = strings.Join(conf.GetStringSlice("dump.exclude-tables"), ",")
+			}
+			if !set["nodata-tables"] {
+				noDataTables = strings.Join(conf.GetStringSlice("dump.nodata-tables"), ",")
+			}
+			if !set["keep-days"] {
+				keepDays = conf.GetInt("dump.keep-days")
+			}
+			if !set["keep-count"] {
+				keepCount = conf.GetInt("dump.keep-count")
+			}
+
+			// Use Format for dump files, so they sort by date and import takes the newest
+			tarFile := filepath.Join(conf.GetString("dbdir"), fmt.Sprintf("dump_%s.tar.gz", time.Now().Format("20060102.150405")))
+
+			conn, err := g.OpenDB()
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			databases := []string{g.MySQLDatabase}
+			if allDatabases {
+				if databases, err = db.ListDatabases(conn); err != nil {
+					return err
+				}
+			}
+
+			// Dumps aren't written in dry-run mode, archive is only added to plan
+			if !plan.Record(plan.Write, "%s, databases %s", tarFile, strings.Join(databases, ",")) {
+				// Dump every database into its own archive entry, all of them
+				// are read from one snapshot
+				snapshot, err := db.BeginSnapshot(ctx, conn)
+				if err != nil {
+					return err
+				}
+				defer snapshot.Close()
+				tw, err := archive.NewTarGzWriter(tarFile)
+				if err != nil {
+					return err
+				}
+				for _, database := range databases {
+					dumper := &db.Dumper{
+						DB:            conn,
+						Snapshot:      snapshot,
+						Database:      database,
+						Tables:        splitList(tables),
+						ExcludeTables: splitList(excludeTables),
+						NoDataTables:  splitList(noDataTables),
+					}
+					err = tw.WriteEntry(database+".sql", func(w io.Writer) error {
+						return dumper.Dump(ctx, w)
+					})
+					if err != nil {
+						tw.Close()
+						os.Remove(tarFile)
+						return fmt.Errorf("dump of %s failed: %v", database, err)
+					}
+				}
+				if err = tw.Close(); err != nil {
+					return err
+				}
+				log.Printf("Database dump %s created\n", tarFile)
+			}
+
+			// Copy dump to remote storage
+			if err = cmd.ExecContext(ctx, "", "rsync", "-P", "-t", tarFile, conf.GetString("storagedir")); err != nil {
+				return err
+			}
+
+			// Rotate dumps on local disk and in remote storage
+			retention := archive.Retention{KeepDays: keepDays, KeepCount: keepCount}
+			for _, dir := range []string{conf.GetString("dbdir"), conf.GetString("storagedir")} {
+				deleted, err := archive.Rotate(dir, "dump_*.tar.gz", retention)
+				if err != nil {
+					return err
+				}
+				for _, file := range deleted {
+					log.Printf("Dump %s deleted by retention policy\n", file)
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// splitList split comma separated flag value
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
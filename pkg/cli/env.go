@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"context"
+	"flag"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/vhost"
+)
+
+const refSlugUsage = "Lowercased, shortened to 63 bytes, and with everything except 0-9 and a-z replaced with -. No leading / trailing -. Use in URLs, host names and domain names."
+
+func init() {
+	var refSlug, commitSha string
+	var force bool
+	register(&Command{
+		Name:  "env",
+		Usage: "env -refslug <refslug> -commitsha <sha> [-force]",
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&refSlug, "refslug", "", refSlugUsage)
+			fs.StringVar(&commitSha, "commitsha", "", "The commit revision for which project is built.")
+			fs.BoolVar(&force, "force", false, "Hard reset virtual host directory to commit of force pushed branch, local changes are lost.")
+		},
+		Run: func(ctx context.Context, g *Globals, args []string) error {
+			conf, err := g.Config()
+			if err != nil {
+				return err
+			}
+			profile, err := g.SelectProfile(conf)
+			if err != nil {
+				return err
+			}
+
+			// Checkout to commit, run deploy commands from env.json
+			_, err = vhost.Deploy(ctx, vhost.Options{
+				RefSlug:   refSlug,
+				CommitSHA: commitSha,
+				Force:     force,
+				Profile:   profile,
+				Conf:      conf,
+			})
+			return err
+		},
+	})
+}
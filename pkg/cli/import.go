@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"context"
+	"flag"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/vhost"
+)
+
+func init() {
+	var refSlug, dump, entry string
+	register(&Command{
+		Name:  "import",
+		Usage: "import -refslug <refslug> -user <user> -password <password> [-dump <file>] [-entry <name>]",
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&refSlug, "refslug", "", refSlugUsage)
+			fs.StringVar(&dump, "dump", "", "Dump to import, the newest dump of storagedir if empty.")
+			fs.StringVar(&entry, "entry", "", "Database of dump with several databases to import, like portal or portal.sql.")
+		},
+		Run: func(ctx context.Context, g *Globals, args []string) error {
+			conf, err := g.Config()
+			if err != nil {
+				return err
+			}
+			profile, err := g.SelectProfile(conf)
+			if err != nil {
+				return err
+			}
+			conn, err := g.OpenDB()
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			_, err = vhost.ImportDatabase(ctx, vhost.Options{
+				RefSlug:   refSlug,
+				Profile:   profile,
+				Conf:      conf,
+				DB:        conn,
+				Dump:      dump,
+				DumpEntry: entry,
+			})
+			return err
+		},
+	})
+}
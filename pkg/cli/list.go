@@ -0,0 +1,183 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/vhost"
+)
+
+func init() {
+	register(&Command{
+		Name:  "list",
+		Usage: "list [-output json] [-user <user> -password <password>]",
+		Run: func(ctx context.Context, g *Globals, args []string) error {
+			conf, err := g.Config()
+			if err != nil {
+				return err
+			}
+			conn := g.openOptionalDB()
+			if conn != nil {
+				defer conn.Close()
+			}
+
+			list, err := vhost.Inventory(ctx, vhost.Options{Conf: conf, DB: conn})
+			if err != nil {
+				return err
+			}
+			if g.JSON() {
+				return writeJSON(list)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "REFSLUG\tPROFILE\tCOMMIT\tPORTS\tDATABASE\tDB SIZE\tNODE\tDISK\tDEPLOYED")
+			for _, s := range list {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					s.RefSlug, dash(s.Profile), dash(shortSHA(s.Commit)), dash(formatPorts(s.Ports)),
+					dash(s.DBName), formatSize(s.DBSize), dash(nodeStatus(s)), formatSize(s.DiskUsage),
+					formatTime(s.LastDeploy))
+			}
+			return w.Flush()
+		},
+	})
+
+	var refSlug string
+	register(&Command{
+		Name:  "status",
+		Usage: "status -refslug <refslug> [-output json] [-user <user> -password <password>]",
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&refSlug, "refslug", "", refSlugUsage)
+		},
+		Run: func(ctx context.Context, g *Globals, args []string) error {
+			if refSlug == "" {
+				return errors.New("set -refslug")
+			}
+			conf, err := g.Config()
+			if err != nil {
+				return err
+			}
+			conn := g.openOptionalDB()
+			if conn != nil {
+				defer conn.Close()
+			}
+
+			s, err := vhost.Inspect(ctx, vhost.Options{RefSlug: refSlug, Conf: conf, DB: conn})
+			if err != nil {
+				return err
+			}
+			if g.JSON() {
+				return writeJSON(s)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "Refslug:\t%s\n", s.RefSlug)
+			fmt.Fprintf(w, "Profile:\t%s\n", dash(s.Profile))
+			fmt.Fprintf(w, "Managed:\t%t\n", s.Managed)
+			fmt.Fprintf(w, "Directory:\t%s\n", s.HostDir)
+			fmt.Fprintf(w, "Commit:\t%s\n", dash(s.Commit))
+			fmt.Fprintf(w, "Ports:\t%s\n", dash(formatPorts(s.Ports)))
+			fmt.Fprintf(w, "Nginx upstream ports:\t%s\n", dash(formatPorts(s.NginxPorts)))
+			fmt.Fprintf(w, "Database:\t%s\n", dash(s.DBName))
+			fmt.Fprintf(w, "Database size:\t%s\n", formatSize(s.DBSize))
+			fmt.Fprintf(w, "PM2 status:\t%s\n", dash(s.PM2Status))
+			if s.PM2Status != "" {
+				fmt.Fprintf(w, "PM2 restarts:\t%d\n", s.PM2Restarts)
+				fmt.Fprintf(w, "PM2 memory:\t%s\n", formatSize(s.PM2Memory))
+			}
+			fmt.Fprintf(w, "Unit status:\t%s\n", dash(s.UnitStatus))
+			fmt.Fprintf(w, "Disk usage:\t%s\n", formatSize(s.DiskUsage))
+			fmt.Fprintf(w, "Last deploy:\t%s\n", formatTime(s.LastDeploy))
+			return w.Flush()
+		},
+	})
+}
+
+// openOptionalDB connect to MySQL if -user is set, databases sizes are shown
+// only then
+func (g *Globals) openOptionalDB() *sql.DB {
+	if g.MySQLUser == "" {
+		return nil
+	}
+	conn, err := g.OpenDB()
+	if err != nil {
+		log.Printf("Database sizes are not shown: %v\n", err)
+		return nil
+	}
+	return conn
+}
+
+// writeJSON print value as indented JSON to standard output
+func writeJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", " ")
+	return enc.Encode(v)
+}
+
+func formatPorts(ports map[string]int) string {
+	services := make([]string, 0, len(ports))
+	for service := range ports {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	list := make([]string, 0, len(services))
+	for _, service := range services {
+		list = append(list, fmt.Sprintf("%s:%d", service, ports[service]))
+	}
+	return strings.Join(list, ",")
+}
+
+// formatSize returns size in human readable units, "-" for negative size
+func formatSize(size int64) string {
+	if size < 0 {
+		return "-"
+	}
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 8 {
+		return sha[:8]
+	}
+	return sha
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// nodeStatus returns status of node application run by pm2 or systemd unit
+func nodeStatus(s *vhost.Status) string {
+	if s.PM2Status != "" {
+		return s.PM2Status
+	}
+	return s.UnitStatus
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/cmd"
+	"github.com/antuspenskiy/automate-vhosts/pkg/vhost"
+)
+
+func init() {
+	var refSlug string
+	register(&Command{
+		Name:  "remove",
+		Usage: "remove -refslug <refslug> -user <user> -password <password>",
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&refSlug, "refslug", "", refSlugUsage+" Remote branches are listed from repository of this virtual host.")
+		},
+		Run: func(ctx context.Context, g *Globals, args []string) error {
+			conf, err := g.Config()
+			if err != nil {
+				return err
+			}
+			profile, err := g.SelectProfile(conf)
+			if err != nil {
+				return err
+			}
+
+			// Virtual hosts which branches are deleted
+			// Services are reloaded once after all virtual hosts are removed
+			opts := vhost.Options{
+				RefSlug: refSlug,
+				Profile: profile,
+				Conf:    conf,
+				Changes: cmd.NewChangeSet(),
+			}
+			stale, err := vhost.Stale(ctx, opts)
+			if err != nil {
+				return err
+			}
+
+			conn, err := g.OpenDB()
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			opts.DB = conn
+
+			// Failed virtual host doesn't stop removal of the next ones, the
+			// command fails at the end
+			failed := 0
+			for _, slug := range stale {
+				// Folders which are not CI_COMMIT_REF_SLUG are not created by av
+				if err = vhost.ValidateRefSlug(slug); err != nil {
+					log.Printf("Skip %v\n", err)
+					continue
+				}
+				fmt.Printf("This folder and settings will be deleted:\n%s\n\n", slug)
+				opts.RefSlug = slug
+				if err = vhost.Remove(ctx, opts); err != nil {
+					log.Printf("%v\n", err)
+					failed++
+				}
+			}
+			if err = opts.Changes.Reload(context.Background()); err != nil {
+				return err
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d virtual hosts are not removed", failed, len(stale))
+			}
+			return nil
+		},
+	})
+}
@@ -1,61 +1,49 @@
 package cmd
 
 import (
-	"bytes"
+	"context"
+	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
-	"syscall"
-)
 
-const defaultFailedCode = 1
+	"github.com/antuspenskiy/automate-vhosts/pkg/plan"
+)
 
-// RunCommand exec command and print stdout,stderr and exitCode
+// RunCommand exec command and print stdout,stderr and exitCode, exit if command fails
 func RunCommand(name string, args ...string) (stdout string, stderr string, exitCode int) {
-	log.Println("run command:", name, args)
-	var outbuf, errbuf bytes.Buffer
-	cmd := exec.Command(name, args...)
-	cmd.Stdout = &outbuf
-	cmd.Stderr = &errbuf
-
-	err := cmd.Run()
-	stdout = outbuf.String()
-	stderr = errbuf.String()
-
-	if err != nil {
-		// try to get the exit code
-		if exitError, ok := err.(*exec.ExitError); ok {
-			ws := exitError.Sys().(syscall.WaitStatus)
-			exitCode = ws.ExitStatus()
-		} else {
-			// This will happen (in OSX) if `name` is not available in $PATH,
-			// in this situation, exit code could not be get, and stderr will be
-			// empty string very likely, so we use the default fail code, and format err
-			// to string and set to stderr
-			log.Printf("Could not get exit code for failed program: %v, %v", name, args)
-			exitCode = defaultFailedCode
-			if stderr == "" {
-				stderr = err.Error()
-			}
-		}
-	} else {
-		// success, exitCode should be 0 if go is ok
-		ws := cmd.ProcessState.Sys().(syscall.WaitStatus)
-		exitCode = ws.ExitStatus()
-	}
+	stdout, stderr, exitCode = (&Command{Name: name, Args: args}).Run(context.Background())
 	if exitCode != 0 {
-		log.Fatalf("command result, stdout: %v, stderr: %v, exitCode: %v", stdout, stderr, exitCode)
+		Fatalf("command result, stdout: %v, stderr: %v, exitCode: %v", stdout, stderr, exitCode)
 	}
-	log.Printf("command result, stdout: %v, stderr: %v, exitCode: %v", stdout, stderr, exitCode)
 	return
 }
 
+// Exec exec command like RunCommand, but returns error when command fails
+func Exec(name string, args ...string) error {
+	return ExecContext(context.Background(), "", name, args...)
+}
+
+// ExecContext exec command in dir, current directory if dir is empty. Output
+// is streamed to log, command and its children are killed when ctx is done.
+// Returns error when command fails.
+func ExecContext(ctx context.Context, dir string, name string, args ...string) error {
+	return ExecEnv(ctx, dir, nil, name, args...)
+}
+
+// ExecEnv exec command like ExecContext with environment variables in form
+// "KEY=value" added to environment of current process
+func ExecEnv(ctx context.Context, dir string, env []string, name string, args ...string) error {
+	return ExecCommand(ctx, &Command{Name: name, Args: args, Dir: dir, Env: env})
+}
+
 // FilePathWalkDir search files in subdirectories
 func FilePathWalkDir(root string) ([]string, error) {
 	var files []string
 	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
 		if !info.IsDir() {
 			files = append(files, path)
 		}
@@ -79,17 +67,6 @@ func Difference(a, b []string) []string {
 	return ab
 }
 
-// Deploy deploy cmd for virtual hosts
-func Deploy(conf string) []string {
-	cmd := conf
-	commands := strings.Split(cmd, ",")
-
-	for _, command := range commands {
-		RunCommand("bash", "-c", command)
-	}
-	return commands
-}
-
 // DirectoryExists returns true if a directory(or file) exists, otherwise false
 func DirectoryExists(dir string) bool {
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
@@ -102,23 +79,49 @@ func DirectoryExists(dir string) bool {
 func GetHostname() string {
 	hostname, err := os.Hostname()
 	if err != nil {
-		log.Fatalf("error get server hostname: %v\n", err)
+		Fatalf("error get server hostname: %v\n", err)
 	}
 	return hostname
 }
 
 // DeleteFile delete file
 func DeleteFile(path string) {
+	if plan.Record(plan.Remove, "%s", path) {
+		return
+	}
 	err := os.Remove(path)
 	if err != nil {
-		log.Fatalf("Error: %v\n\n", err)
+		Fatalf("Error: %v\n\n", err)
 	}
 	log.Printf("File %s deleted. \n", path)
 }
 
+// Mkdir create directory, in dry-run mode directory is only added to plan
+func Mkdir(dir string, perm os.FileMode) error {
+	if plan.Record(plan.Mkdir, "%s %o", dir, perm) {
+		return nil
+	}
+	return os.Mkdir(dir, perm)
+}
+
+// RemoveAll remove file or directory with its content, in dry-run mode path
+// is only added to plan
+func RemoveAll(path string) error {
+	if plan.Record(plan.Remove, "%s", path) {
+		return nil
+	}
+	return os.RemoveAll(path)
+}
+
 // Check error checking
 func Check(err error) {
 	if err != nil {
-		log.Fatalln(err)
+		Fatalf("%v", err)
 	}
 }
+
+// Fatalf log error and exit with status 1
+func Fatalf(format string, v ...interface{}) {
+	log.Print(fmt.Sprintf(format, v...))
+	os.Exit(1)
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Conditions of deploy step, Step.When is one of them
+const (
+	// WhenAlways step runs on every deploy, it is the default
+	WhenAlways = "always"
+	// WhenCreate step runs on the first deploy into new virtual host directory
+	WhenCreate = "create"
+	// WhenUpdate step runs on deploy into existing virtual host directory
+	WhenUpdate = "update"
+)
+
+// Step is a deploy command declared in "deploy" section of env.json or profile
+type Step struct {
+	Name string `mapstructure:"name"`
+	// Argv is run without shell, Shell is run by bash -c, one of them is set
+	Argv  []string `mapstructure:"argv"`
+	Shell string   `mapstructure:"shell"`
+	// Dir is relative to virtual host directory, if it is not absolute
+	Dir string `mapstructure:"dir"`
+	// Env is a list of "KEY=value", viper would lowercase keys of a map
+	Env []string `mapstructure:"env"`
+	// Timeout of one attempt, no timeout if zero
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Retries is number of attempts after failed one
+	Retries int `mapstructure:"retries"`
+	// ContinueOnError let the next steps run if step fails
+	ContinueOnError bool   `mapstructure:"continue-on-error"`
+	When            string `mapstructure:"when"`
+}
+
+// StepResult is result of deploy step
+type StepResult struct {
+	Name     string
+	Skipped  bool
+	Attempts int
+	Duration time.Duration
+	Err      error
+}
+
+// ShellSteps returns steps of comma separated shell commands, the format of
+// "cmd-dir-exist" and "cmd-dir-not-exist" before structured steps
+func ShellSteps(commands string, when string) []Step {
+	var steps []Step
+	for _, command := range strings.Split(commands, ",") {
+		command = strings.TrimSpace(command)
+		if command == "" {
+			continue
+		}
+		steps = append(steps, Step{Shell: command, When: when})
+	}
+	return steps
+}
+
+func (s *Step) validate() error {
+	if (len(s.Argv) == 0) == (s.Shell == "") {
+		return fmt.Errorf("deploy step %s: set one of argv or shell", s.title())
+	}
+	switch s.When {
+	case "", WhenAlways, WhenCreate, WhenUpdate:
+	default:
+		return fmt.Errorf("deploy step %s: unknown condition %s", s.title(), s.When)
+	}
+	for _, env := range s.Env {
+		if !strings.Contains(env, "=") {
+			return fmt.Errorf("deploy step %s: env %s is not KEY=value", s.title(), env)
+		}
+	}
+	if s.Retries < 0 {
+		return fmt.Errorf("deploy step %s: negative retries", s.title())
+	}
+	return nil
+}
+
+// title returns name of step, command if name is not set
+func (s *Step) title() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	if s.Shell != "" {
+		return s.Shell
+	}
+	return strings.Join(s.Argv, " ")
+}
+
+// runs returns true if step runs on deploy of kind when: create or update
+func (s *Step) runs(when string) bool {
+	return s.When == "" || s.When == WhenAlways || s.When == when
+}
+
+func (s *Step) run(ctx context.Context, dir string) error {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	if s.Dir != "" {
+		if filepath.IsAbs(s.Dir) {
+			dir = s.Dir
+		} else {
+			dir = filepath.Join(dir, s.Dir)
+		}
+	}
+	c := &Command{Dir: dir, Env: s.Env, Prefix: s.title()}
+	if s.Shell != "" {
+		c.Name, c.Args = "bash", []string{"-c", s.Shell}
+	} else {
+		c.Name, c.Args = s.Argv[0], s.Argv[1:]
+	}
+	err := ExecCommand(ctx, c)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timeout %s: %v", s.Timeout, err)
+	}
+	return err
+}
+
+// RunSteps run deploy steps of kind when (create or update) in virtual host
+// directory dir. Failed step is retried, the first failed step without
+// continue-on-error stops deploy and the next steps are skipped. Returns
+// result of every step and error of stopping step.
+func RunSteps(ctx context.Context, dir string, when string, steps []Step) ([]StepResult, error) {
+	for i := range steps {
+		if err := steps[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]StepResult, 0, len(steps))
+	var stopErr error
+	for i := range steps {
+		s := &steps[i]
+		r := StepResult{Name: s.title()}
+		if stopErr != nil || !s.runs(when) {
+			r.Skipped = true
+			results = append(results, r)
+			continue
+		}
+
+		log.Printf("Deploy step: %s\n", r.Name)
+		start := time.Now()
+		for r.Attempts = 1; ; r.Attempts++ {
+			r.Err = s.run(ctx, dir)
+			if r.Err == nil || r.Attempts > s.Retries || ctx.Err() != nil {
+				break
+			}
+			log.Printf("Deploy step %s failed, retry %d of %d: %v\n", r.Name, r.Attempts, s.Retries, r.Err)
+		}
+		r.Duration = time.Since(start)
+		results = append(results, r)
+
+		if r.Err != nil && !s.ContinueOnError {
+			stopErr = fmt.Errorf("deploy step %s: %v", r.Name, r.Err)
+		}
+	}
+	return results, stopErr
+}
+
+// PrintSteps print summary of deploy step results
+func PrintSteps(w io.Writer, results []StepResult) {
+	fmt.Fprintf(w, "\nDeploy summary:\n")
+	for _, r := range results {
+		switch {
+		case r.Skipped:
+			fmt.Fprintf(w, "  skipped  %s\n", r.Name)
+		case r.Err != nil:
+			fmt.Fprintf(w, "  failed   %s (%d attempts, %s): %v\n", r.Name, r.Attempts, r.Duration.Round(time.Second), r.Err)
+		default:
+			fmt.Fprintf(w, "  ok       %s (%d attempts, %s)\n", r.Name, r.Attempts, r.Duration.Round(time.Second))
+		}
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShellSteps(t *testing.T) {
+	got := ShellSteps(" composer install --no-dev, ,yarn build ,", WhenUpdate)
+	want := []Step{
+		{Shell: "composer install --no-dev", When: WhenUpdate},
+		{Shell: "yarn build", When: WhenUpdate},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ShellSteps = %+v, want %+v", got, want)
+	}
+	if steps := ShellSteps("", WhenCreate); len(steps) != 0 {
+		t.Errorf("ShellSteps of empty string = %+v", steps)
+	}
+}
+
+func TestStepValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		step Step
+		err  string
+	}{
+		{"argv", Step{Argv: []string{"yarn"}}, ""},
+		{"shell", Step{Shell: "yarn build", When: WhenCreate, Env: []string{"NODE_ENV=production"}}, ""},
+		{"no command", Step{Name: "empty"}, "set one of argv or shell"},
+		{"both commands", Step{Argv: []string{"yarn"}, Shell: "yarn"}, "set one of argv or shell"},
+		{"unknown condition", Step{Shell: "yarn", When: "sometimes"}, "unknown condition"},
+		{"env without value", Step{Shell: "yarn", Env: []string{"NODE_ENV"}}, "is not KEY=value"},
+		{"negative retries", Step{Shell: "yarn", Retries: -1}, "negative retries"},
+	}
+	for _, tt := range tests {
+		err := tt.step.validate()
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: validate = %v, want nil", tt.name, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: validate = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestRunSteps(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	steps := []Step{
+		{Name: "create", Shell: "echo create >> log", When: WhenCreate},
+		{Name: "update", Shell: "echo update >> log", When: WhenUpdate},
+		{Name: "dir", Argv: []string{"touch", "built"}, Dir: "app"},
+		// Fails twice, succeeds on the third attempt
+		{Name: "flaky", Shell: "echo x >> attempts; [ $(wc -l < attempts) -ge 3 ]", Retries: 2},
+		{Name: "optional", Argv: []string{"false"}, ContinueOnError: true},
+		{Name: "env", Shell: `echo "$MODE" >> log`, Env: []string{"MODE=production"}},
+		{Name: "broken", Argv: []string{"false"}},
+		{Name: "after broken", Shell: "echo after >> log"},
+	}
+	results, err := RunSteps(context.Background(), dir, WhenUpdate, steps)
+	if err == nil || !strings.Contains(err.Error(), "deploy step broken") {
+		t.Errorf("RunSteps error = %v, want error of broken step", err)
+	}
+
+	type result struct {
+		Name     string
+		Skipped  bool
+		Attempts int
+		Failed   bool
+	}
+	var got []result
+	for _, r := range results {
+		got = append(got, result{r.Name, r.Skipped, r.Attempts, r.Err != nil})
+	}
+	want := []result{
+		{"create", true, 0, false},
+		{"update", false, 1, false},
+		{"dir", false, 1, false},
+		{"flaky", false, 3, false},
+		{"optional", false, 1, true},
+		{"env", false, 1, false},
+		{"broken", false, 1, true},
+		{"after broken", true, 0, false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("results = %+v, want %+v", got, want)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "update\nproduction\n" {
+		t.Errorf("log = %q, want %q", data, "update\nproduction\n")
+	}
+	if !DirectoryExists(filepath.Join(dir, "app", "built")) {
+		t.Errorf("step with dir didn't run in app directory")
+	}
+}
+
+func TestRunStepsInvalid(t *testing.T) {
+	steps := []Step{
+		{Name: "ok", Shell: "touch ran"},
+		{Name: "invalid"},
+	}
+	dir := t.TempDir()
+	if _, err := RunSteps(context.Background(), dir, WhenCreate, steps); err == nil {
+		t.Errorf("RunSteps with invalid step = nil, want error")
+	}
+	if DirectoryExists(filepath.Join(dir, "ran")) {
+		t.Errorf("steps ran before invalid step was found")
+	}
+}
+
+func TestRunStepsTimeout(t *testing.T) {
+	steps := []Step{{Name: "slow", Argv: []string{"sleep", "30"}, Timeout: 100 * time.Millisecond}}
+	start := time.Now()
+	results, err := RunSteps(context.Background(), t.TempDir(), WhenCreate, steps)
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("RunSteps error = %v, want timeout", err)
+	}
+	if len(results) != 1 || results[0].Err == nil {
+		t.Errorf("results = %+v, want failed slow step", results)
+	}
+	if d := time.Since(start); d > killGrace {
+		t.Errorf("step with timeout ran %s", d)
+	}
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+)
+
+// ChangeSet records services which configuration is changed, they are
+// reloaded once by Reload. Every caller keeps its own set, so operations
+// running in the same process don't reload services of each other. Methods of
+// nil set do nothing.
+type ChangeSet struct {
+	mu       sync.Mutex
+	services map[string]bool
+}
+
+// NewChangeSet returns empty set of changed services
+func NewChangeSet() *ChangeSet {
+	return &ChangeSet{services: make(map[string]bool)}
+}
+
+// MarkChanged record services which configuration is changed
+func (c *ChangeSet) MarkChanged(services ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, service := range services {
+		c.services[service] = true
+	}
+}
+
+// Changed returns sorted services which configuration is changed
+func (c *ChangeSet) Changed() []string {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	services := make([]string, 0, len(c.services))
+	for service := range c.services {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	return services
+}
+
+// Reload gracefully reload services which configuration is changed by
+// current service manager and forget them. Workers finish requests in flight,
+// unlike restart.
+func (c *ChangeSet) Reload(ctx context.Context) error {
+	services := c.Changed()
+	if c == nil || len(services) == 0 {
+		return nil
+	}
+	c.mu.Lock()
+	c.services = make(map[string]bool)
+	c.mu.Unlock()
+
+	log.Printf("Reload %v\n", services)
+	return Services().Reload(ctx, services...)
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// undoAction revert one provisioning step
+type undoAction struct {
+	name string
+	fn   func() error
+}
+
+// UndoLog records undo actions of one operation, so operations running in
+// the same process don't roll back each other. Zero value is ready to use.
+type UndoLog struct {
+	mu      sync.Mutex
+	actions []undoAction
+}
+
+// Undo register action which reverts a provisioning step. On failure actions
+// run in reverse order, so virtual host is left in clean state and the next
+// run starts from scratch.
+func (l *UndoLog) Undo(name string, fn func() error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.actions = append(l.actions, undoAction{name: name, fn: fn})
+}
+
+// Commit forget registered undo actions, provisioning steps are kept
+func (l *UndoLog) Commit() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.actions = nil
+}
+
+// Rollback run registered undo actions in reverse order. Failed action doesn't
+// stop rollback, errors are returned together. Returns number of actions run.
+func (l *UndoLog) Rollback() (int, error) {
+	l.mu.Lock()
+	actions := l.actions
+	l.actions = nil
+	l.mu.Unlock()
+
+	var failed []string
+	for i := len(actions) - 1; i >= 0; i-- {
+		log.Printf("Rollback: %s\n", actions[i].name)
+		if err := actions[i].fn(); err != nil {
+			log.Printf("Rollback: %s failed: %v\n", actions[i].name, err)
+			failed = append(failed, fmt.Sprintf("%s: %v", actions[i].name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return len(actions), fmt.Errorf("rollback incomplete, %s", strings.Join(failed, "; "))
+	}
+	return len(actions), nil
+}
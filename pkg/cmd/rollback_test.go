@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUndoLogRollback(t *testing.T) {
+	var undone []string
+	undo := func(name string, err error) func() error {
+		return func() error {
+			undone = append(undone, name)
+			return err
+		}
+	}
+
+	var l UndoLog
+	l.Undo("create directory", undo("create directory", nil))
+	l.Undo("create database", undo("create database", errors.New("access denied")))
+	l.Undo("start pm2", undo("start pm2", nil))
+
+	// Actions run in reverse order, failed one doesn't stop rollback
+	n, err := l.Rollback()
+	if n != 3 {
+		t.Errorf("Rollback ran %d actions, want 3", n)
+	}
+	if err == nil || !strings.Contains(err.Error(), "create database: access denied") {
+		t.Errorf("Rollback error = %v, want error of create database", err)
+	}
+	want := []string{"start pm2", "create database", "create directory"}
+	if !reflect.DeepEqual(undone, want) {
+		t.Errorf("undone %q, want %q", undone, want)
+	}
+
+	// Actions are forgotten after rollback
+	if n, err = l.Rollback(); n != 0 || err != nil {
+		t.Errorf("second Rollback = %d, %v, want 0, nil", n, err)
+	}
+}
+
+func TestUndoLogCommit(t *testing.T) {
+	var l, other UndoLog
+	l.Undo("remove file", func() error {
+		t.Error("committed action is run")
+		return nil
+	})
+	ran := false
+	other.Undo("remove file of another operation", func() error {
+		ran = true
+		return nil
+	})
+
+	l.Commit()
+	if n, err := l.Rollback(); n != 0 || err != nil {
+		t.Errorf("Rollback after Commit = %d, %v, want 0, nil", n, err)
+	}
+	// Logs of other operations are not affected
+	if n, _ := other.Rollback(); n != 1 || !ran {
+		t.Errorf("Rollback of another log ran %d actions, want 1", n)
+	}
+}
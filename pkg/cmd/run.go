@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/plan"
+)
+
+const defaultFailedCode = 1
+
+// killGrace is time between SIGTERM and SIGKILL of cancelled command
+const killGrace = 5 * time.Second
+
+// errorTail is number of last output lines in error of failed command, the
+// whole output is already streamed to log
+const errorTail = 20
+
+// outputTail is number of last bytes of stdout and stderr kept by Run, so
+// memory doesn't grow with output of long builds
+const outputTail = 64 * 1024
+
+// Command is a command which output is streamed line by line while it runs
+type Command struct {
+	Name string
+	Args []string
+	// Dir is working directory, current directory if empty
+	Dir string
+	// Env is added to environment of current process, in form "KEY=value"
+	Env []string
+	// Prefix of output lines, base name of command if empty
+	Prefix string
+	// Output receives output lines, log output if nil
+	Output io.Writer
+}
+
+// String returns command line with environment
+func (c *Command) String() string {
+	parts := append(append(c.Env[:len(c.Env):len(c.Env)], c.Name), c.Args...)
+	return strings.Join(parts, " ")
+}
+
+// Run start command in its own process group and stream its stdout and
+// stderr. When ctx is done the whole group gets SIGTERM and, after grace
+// period, SIGKILL, so children like node or php workers don't outlive it.
+// Returns the last 64 KiB of stdout and stderr and exit code, -1 if command is
+// killed by signal.
+func (c *Command) Run(ctx context.Context) (stdout string, stderr string, exitCode int) {
+	if c.Dir != "" {
+		if plan.Record(plan.Command, "cd %s && %s", c.Dir, c) {
+			return
+		}
+	} else if plan.Record(plan.Command, "%s", c) {
+		return
+	}
+	log.Println("run command:", c.Name, c.Args)
+
+	prefix := c.Prefix
+	if prefix == "" {
+		prefix = filepath.Base(c.Name)
+	}
+	out := c.Output
+	if out == nil {
+		out = log.Writer()
+	}
+	var mu sync.Mutex
+	outLines := &lineWriter{w: out, mu: &mu, prefix: prefix + " | "}
+	errLines := &lineWriter{w: out, mu: &mu, prefix: prefix + " ! "}
+
+	outbuf, errbuf := &tailBuffer{max: outputTail}, &tailBuffer{max: outputTail}
+	cmd := exec.Command(c.Name, c.Args...)
+	cmd.Dir = c.Dir
+	if len(c.Env) > 0 {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+	cmd.Stdout = io.MultiWriter(outbuf, outLines)
+	cmd.Stderr = io.MultiWriter(errbuf, errLines)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	// Child which left process group may keep pipes open after command exits
+	// or is killed, Wait doesn't wait for it longer than grace period
+	cmd.WaitDelay = killGrace
+
+	err := ctx.Err()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err == nil {
+		done := make(chan struct{})
+		go killGroup(ctx, cmd.Process.Pid, done)
+		err = cmd.Wait()
+		close(done)
+		if errors.Is(err, exec.ErrWaitDelay) {
+			log.Printf("command %s exited, but its child keeps output open, output is not read further", c.Name)
+			err = nil
+		}
+	}
+	outLines.flush()
+	errLines.flush()
+	stdout = outbuf.String()
+	stderr = errbuf.String()
+
+	if err != nil {
+		// try to get the exit code
+		if exitError, ok := err.(*exec.ExitError); ok {
+			ws := exitError.Sys().(syscall.WaitStatus)
+			exitCode = ws.ExitStatus()
+		} else {
+			// This will happen if `name` is not available in $PATH or ctx is
+			// done before start, in this situation, exit code could not be
+			// get, so we use the default fail code, and format err to string
+			// and set to stderr
+			log.Printf("Could not get exit code for failed program: %v, %v", c.Name, c.Args)
+			exitCode = defaultFailedCode
+			if stderr == "" {
+				stderr = err.Error()
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		log.Printf("command %s is cancelled: %v", c.Name, ctx.Err())
+	}
+	log.Printf("command result, exitCode: %v", exitCode)
+	return
+}
+
+// killGroup terminate process group of pid when ctx is done, until done is closed
+func killGroup(ctx context.Context, pid int, done chan struct{}) {
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+	syscall.Kill(-pid, syscall.SIGTERM)
+	select {
+	case <-done:
+	case <-time.After(killGrace):
+		syscall.Kill(-pid, syscall.SIGKILL)
+	}
+}
+
+// ExecCommand run command and returns error with last lines of its output
+// when it fails
+func ExecCommand(ctx context.Context, c *Command) error {
+	stdout, stderr, exitCode := c.Run(ctx)
+	if exitCode == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("%s %s: exit code %d, stdout: %s, stderr: %s",
+		c.Name, strings.Join(c.Args, " "), exitCode, tail(stdout, errorTail), tail(stderr, errorTail))
+	if ctx.Err() != nil {
+		msg += fmt.Sprintf(" (%v)", ctx.Err())
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+// tail returns last n lines of s
+func tail(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) <= n {
+		return strings.Join(lines, "\n")
+	}
+	return "...\n" + strings.Join(lines[len(lines)-n:], "\n")
+}
+
+// tailBuffer keeps the last max bytes written to it
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(p) >= t.max {
+		t.buf = append(t.buf[:0], p[len(p)-t.max:]...)
+		return n, nil
+	}
+	if drop := len(t.buf) + len(p) - t.max; drop > 0 {
+		t.buf = append(t.buf[:0], t.buf[drop:]...)
+	}
+	t.buf = append(t.buf, p...)
+	return n, nil
+}
+
+func (t *tailBuffer) String() string {
+	return string(t.buf)
+}
+
+// lineWriter write complete lines with prefix, stdout and stderr writers
+// share mutex, so their lines don't interleave
+type lineWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    []byte
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		fmt.Fprintf(l.w, "%s%s\n", l.prefix, l.buf[:i])
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush write the last line without newline
+func (l *lineWriter) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.buf) > 0 {
+		fmt.Fprintf(l.w, "%s%s\n", l.prefix, l.buf)
+		l.buf = nil
+	}
+}
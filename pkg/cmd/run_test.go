@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTailBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"empty", nil, ""},
+		{"short", []string{"ab", "cd"}, "abcd"},
+		{"exact", []string{"abcde"}, "abcde"},
+		{"long write", []string{"abcdefgh"}, "defgh"},
+		{"many writes", []string{"abc", "def", "gh"}, "defgh"},
+		{"long write after short", []string{"ab", "cdefghij"}, "fghij"},
+	}
+	for _, tt := range tests {
+		b := &tailBuffer{max: 5}
+		for _, s := range tt.writes {
+			if n, err := b.Write([]byte(s)); n != len(s) || err != nil {
+				t.Errorf("%s: Write(%q) = %d, %v", tt.name, s, n, err)
+			}
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s: tail = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCommandRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		c        Command
+		stdout   string
+		stderr   string
+		exitCode int
+		lines    []string
+	}{
+		{
+			name:   "output",
+			c:      Command{Name: "bash", Args: []string{"-c", "echo one; echo two >&2; printf three"}, Prefix: "step"},
+			stdout: "one\nthree",
+			stderr: "two\n",
+			lines:  []string{"step | one", "step ! two", "step | three"},
+		},
+		{
+			name:     "exit code",
+			c:        Command{Name: "bash", Args: []string{"-c", "exit 3"}},
+			exitCode: 3,
+		},
+		{
+			name:   "environment and directory",
+			c:      Command{Name: "bash", Args: []string{"-c", `echo "$GREETING $(pwd)"`}, Env: []string{"GREETING=hi"}, Dir: "/"},
+			stdout: "hi /\n",
+			lines:  []string{"bash | hi /"},
+		},
+		{
+			name:     "missing command",
+			c:        Command{Name: "/nonexistent/command"},
+			exitCode: defaultFailedCode,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			tt.c.Output = &out
+			stdout, stderr, exitCode := tt.c.Run(context.Background())
+			if exitCode != tt.exitCode {
+				t.Errorf("exit code = %d, want %d", exitCode, tt.exitCode)
+			}
+			if tt.exitCode == defaultFailedCode && stderr == "" {
+				t.Errorf("stderr of missing command is empty")
+			}
+			if tt.exitCode == 0 && (stdout != tt.stdout || stderr != tt.stderr) {
+				t.Errorf("output = %q, %q, want %q, %q", stdout, stderr, tt.stdout, tt.stderr)
+			}
+			for _, line := range tt.lines {
+				if !strings.Contains(out.String(), line+"\n") {
+					t.Errorf("streamed output %q doesn't contain %q", out.String(), line)
+				}
+			}
+		})
+	}
+}
+
+func TestCommandRunBoundedOutput(t *testing.T) {
+	var out strings.Builder
+	c := &Command{Name: "bash", Args: []string{"-c", "head -c 200000 /dev/zero | tr '\\0' x; echo; echo last"}, Output: &out}
+	stdout, _, exitCode := c.Run(context.Background())
+	if exitCode != 0 {
+		t.Fatalf("exit code = %d", exitCode)
+	}
+	if len(stdout) != outputTail || !strings.HasSuffix(stdout, "\nlast\n") {
+		t.Errorf("stdout is %d bytes ending with %q, want the last %d bytes", len(stdout), stdout[len(stdout)-10:], outputTail)
+	}
+}
+
+func TestCommandRunCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	// Child of shell is in the same process group, it is killed too and
+	// doesn't keep output pipe open
+	c := &Command{Name: "bash", Args: []string{"-c", "sleep 30 & sleep 30; wait"}, Output: &strings.Builder{}}
+	start := time.Now()
+	_, _, exitCode := c.Run(ctx)
+	if exitCode == 0 {
+		t.Errorf("exit code of cancelled command = 0")
+	}
+	if d := time.Since(start); d > killGrace {
+		t.Errorf("cancelled command ran %s", d)
+	}
+}
+
+func TestCommandRunEscapedChild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for grace period")
+	}
+	// Child in its own session keeps stdout open after command exits, Run
+	// returns after grace period with exit code of command
+	c := &Command{Name: "bash", Args: []string{"-c", "setsid sleep 7 & echo started"}, Output: &strings.Builder{}}
+	start := time.Now()
+	stdout, _, exitCode := c.Run(context.Background())
+	if exitCode != 0 || stdout != "started\n" {
+		t.Errorf("Run = %q, %d, want %q, 0", stdout, exitCode, "started\n")
+	}
+	if d := time.Since(start); d > 2*killGrace {
+		t.Errorf("Run waited %s for escaped child", d)
+	}
+}
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Status of service returned by ServiceManager.Status
+const (
+	StatusActive   = "active"
+	StatusInactive = "inactive"
+)
+
+// ServiceManager control system services like nginx and php-fpm. Services are
+// named by generic names, manager maps them to unit names of the server.
+type ServiceManager interface {
+	// Reload gracefully reload configuration of services
+	Reload(ctx context.Context, services ...string) error
+	// Restart stop and start services
+	Restart(ctx context.Context, services ...string) error
+	// Status returns state of service: active, inactive, failed, ...
+	Status(ctx context.Context, service string) (string, error)
+	// IsActive returns true if service is running
+	IsActive(ctx context.Context, service string) (bool, error)
+}
+
+// Units map generic service names to unit names, like php-fpm to php7.4-fpm.
+// Services which are not in the map keep their names.
+type Units map[string]string
+
+// Unit returns unit name of service
+func (u Units) Unit(service string) string {
+	if unit, ok := u[service]; ok && unit != "" {
+		return unit
+	}
+	return service
+}
+
+func (u Units) units(services []string) []string {
+	units := make([]string, 0, len(services))
+	for _, service := range services {
+		units = append(units, u.Unit(service))
+	}
+	return units
+}
+
+// Systemctl manage services by systemd, all services are controlled by one command
+type Systemctl struct {
+	Units Units
+}
+
+// Reload run systemctl reload
+func (s *Systemctl) Reload(ctx context.Context, services ...string) error {
+	return ExecContext(ctx, "", "systemctl", append([]string{"reload"}, s.Units.units(services)...)...)
+}
+
+// Restart run systemctl restart
+func (s *Systemctl) Restart(ctx context.Context, services ...string) error {
+	return ExecContext(ctx, "", "systemctl", append([]string{"restart"}, s.Units.units(services)...)...)
+}
+
+// Status returns output of systemctl is-active, it is run in dry-run mode too
+func (s *Systemctl) Status(ctx context.Context, service string) (string, error) {
+	out, err := exec.CommandContext(ctx, "systemctl", "is-active", s.Units.Unit(service)).Output()
+	status := strings.TrimSpace(string(out))
+	// is-active exits with non-zero status for inactive units and prints their state
+	if _, ok := err.(*exec.ExitError); ok && status != "" {
+		return status, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("systemctl is-active %s: %v", s.Units.Unit(service), err)
+	}
+	return status, nil
+}
+
+// IsActive returns true if systemd unit is active
+func (s *Systemctl) IsActive(ctx context.Context, service string) (bool, error) {
+	status, err := s.Status(ctx, service)
+	return status == StatusActive, err
+}
+
+// SysV manage services by init scripts with service command, one command runs per service
+type SysV struct {
+	Units Units
+}
+
+// Reload run service <name> reload
+func (s *SysV) Reload(ctx context.Context, services ...string) error {
+	return s.each(ctx, "reload", services)
+}
+
+// Restart run service <name> restart
+func (s *SysV) Restart(ctx context.Context, services ...string) error {
+	return s.each(ctx, "restart", services)
+}
+
+func (s *SysV) each(ctx context.Context, action string, services []string) error {
+	for _, unit := range s.Units.units(services) {
+		if err := ExecContext(ctx, "", "service", unit, action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Status returns active if init script status exits with zero status,
+// inactive otherwise
+func (s *SysV) Status(ctx context.Context, service string) (string, error) {
+	err := exec.CommandContext(ctx, "service", s.Units.Unit(service), "status").Run()
+	if _, ok := err.(*exec.ExitError); ok {
+		return StatusInactive, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("service %s status: %v", s.Units.Unit(service), err)
+	}
+	return StatusActive, nil
+}
+
+// IsActive returns true if init script status exits with zero status
+func (s *SysV) IsActive(ctx context.Context, service string) (bool, error) {
+	status, err := s.Status(ctx, service)
+	return status == StatusActive, err
+}
+
+// Fake is an in-memory ServiceManager for tests. Reloaded and restarted
+// services become active, Calls records every call like "reload nginx".
+type Fake struct {
+	mu     sync.Mutex
+	Active map[string]bool
+	Calls  []string
+	// Err is returned by Reload and Restart if set
+	Err error
+}
+
+// Reload record reload of services
+func (f *Fake) Reload(ctx context.Context, services ...string) error {
+	return f.record("reload", services)
+}
+
+// Restart record restart of services
+func (f *Fake) Restart(ctx context.Context, services ...string) error {
+	return f.record("restart", services)
+}
+
+func (f *Fake) record(action string, services []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Calls = append(f.Calls, action+" "+strings.Join(services, " "))
+	if f.Err != nil {
+		return f.Err
+	}
+	if f.Active == nil {
+		f.Active = make(map[string]bool)
+	}
+	for _, service := range services {
+		f.Active[service] = true
+	}
+	return nil
+}
+
+// Status returns active for services in Active map
+func (f *Fake) Status(ctx context.Context, service string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Active[service] {
+		return StatusActive, nil
+	}
+	return StatusInactive, nil
+}
+
+// IsActive returns true for services in Active map
+func (f *Fake) IsActive(ctx context.Context, service string) (bool, error) {
+	status, err := f.Status(ctx, service)
+	return status == StatusActive, err
+}
+
+var (
+	managerMu sync.Mutex
+	manager   ServiceManager = &Systemctl{}
+)
+
+// SetServiceManager replace manager used to reload changed services,
+// systemd is used by default
+func SetServiceManager(m ServiceManager) {
+	managerMu.Lock()
+	defer managerMu.Unlock()
+	manager = m
+}
+
+// Services returns current service manager
+func Services() ServiceManager {
+	managerMu.Lock()
+	defer managerMu.Unlock()
+	return manager
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// useFake replace service manager with Fake until the end of test
+func useFake(t *testing.T) *Fake {
+	t.Helper()
+	fake := &Fake{}
+	prev := Services()
+	SetServiceManager(fake)
+	t.Cleanup(func() { SetServiceManager(prev) })
+	return fake
+}
+
+func TestUnits(t *testing.T) {
+	units := Units{"php-fpm": "php7.4-fpm", "nginx": ""}
+	tests := []struct {
+		service string
+		want    string
+	}{
+		{"php-fpm", "php7.4-fpm"},
+		{"nginx", "nginx"},
+		{"redis", "redis"},
+	}
+	for _, tt := range tests {
+		if got := units.Unit(tt.service); got != tt.want {
+			t.Errorf("Unit(%s) = %s, want %s", tt.service, got, tt.want)
+		}
+	}
+}
+
+func TestChangeSetReload(t *testing.T) {
+	fake := useFake(t)
+	ctx := context.Background()
+
+	// Every service is reloaded once, in sorted order
+	changes := NewChangeSet()
+	changes.MarkChanged("php-fpm")
+	changes.MarkChanged("nginx", "php-fpm")
+	if err := changes.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing is changed since the last reload
+	if err := changes.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Set of another operation is reloaded separately
+	other := NewChangeSet()
+	other.MarkChanged("nginx")
+	if err := other.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Nil set does nothing
+	var none *ChangeSet
+	none.MarkChanged("nginx")
+	if err := none.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"reload nginx php-fpm", "reload nginx"}
+	if !reflect.DeepEqual(fake.Calls, want) {
+		t.Errorf("calls = %q, want %q", fake.Calls, want)
+	}
+	for _, service := range []string{"nginx", "php-fpm"} {
+		if active, _ := fake.IsActive(ctx, service); !active {
+			t.Errorf("%s is not active after reload", service)
+		}
+	}
+	if status, _ := fake.Status(ctx, "redis"); status != StatusInactive {
+		t.Errorf("status of redis = %s, want %s", status, StatusInactive)
+	}
+}
+
+func TestChangeSetReloadError(t *testing.T) {
+	fake := useFake(t)
+	fake.Err = errors.New("nginx: configuration test failed")
+
+	changes := NewChangeSet()
+	changes.MarkChanged("nginx")
+	if err := changes.Reload(context.Background()); err != fake.Err {
+		t.Errorf("Reload = %v, want %v", err, fake.Err)
+	}
+	if active, _ := fake.IsActive(context.Background(), "nginx"); active {
+		t.Errorf("nginx is active after failed reload")
+	}
+}
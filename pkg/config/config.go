@@ -3,10 +3,14 @@ package config
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"text/template"
 
+	"github.com/antuspenskiy/automate-vhosts/pkg/cmd"
+	"github.com/antuspenskiy/automate-vhosts/pkg/plan"
+	"github.com/antuspenskiy/automate-vhosts/pkg/state"
 	"github.com/spf13/viper"
 )
 
@@ -20,25 +24,33 @@ func ReadConfig(filename string) (*viper.Viper, error) {
 	return v, err
 }
 
+// ReadConfigFile read json environment file by path
+func ReadConfigFile(path string) (*viper.Viper, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.AutomaticEnv()
+	err := v.ReadInConfig()
+	return v, err
+}
+
 // WriteJSONToFile write json file
 func WriteJSONToFile(path string, i interface{}) error {
-	data, _ := json.Marshal(i)
-	err := ioutil.WriteFile(path, data, 0644)
+	data, err := json.Marshal(i)
 	if err != nil {
-		log.Fatalf("Error: %v\n\n", err)
 		return err
 	}
-	return nil
+	if plan.Record(plan.Write, "%s, %d bytes", path, len(data)) {
+		return nil
+	}
+	return ioutil.WriteFile(path, data, 0644)
 }
 
 // WriteToFile write file
 func WriteToFile(path string, s string) error {
-	err := ioutil.WriteFile(path, []byte(s), 0644)
-	if err != nil {
-		log.Fatalf("Error: %v\n\n", err)
-		return err
+	if plan.Record(plan.Write, "%s, %d bytes", path, len(s)) {
+		return nil
 	}
-	return nil
+	return ioutil.WriteFile(path, []byte(s), 0644)
 }
 
 // PrettyJSON print json file in pretty format
@@ -50,6 +62,19 @@ func PrettyJSON(i interface{}) string {
 	return string(data)
 }
 
+// RenderTemplate parse template file and execute it with data
+func RenderTemplate(templateFileName string, data interface{}) ([]byte, error) {
+	t, err := template.ParseFiles(templateFileName)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	if err = t.Execute(buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // ParseTemplate is parse struct variables in different templates for configuration files
 func ParseTemplate(templateFileName string, data interface{}) string {
 	t, err := template.ParseFiles(templateFileName)
@@ -62,3 +87,23 @@ func ParseTemplate(templateFileName string, data interface{}) string {
 	}
 	return buf.String()
 }
+
+// OpenState returns state store from statedir of env.json
+func OpenState(conf *viper.Viper) *state.Store {
+	return state.NewStore(conf.GetString("statedir"))
+}
+
+// ServiceManagerFromConfig returns service manager from "services" section of
+// env.json, like "services": {"manager": "systemd", "units": {"php-fpm": "php7.4-fpm"}}.
+// Manager is systemd if not set.
+func ServiceManagerFromConfig(conf *viper.Viper) (cmd.ServiceManager, error) {
+	units := cmd.Units(conf.GetStringMapString("services.units"))
+	switch manager := conf.GetString("services.manager"); manager {
+	case "", "systemd":
+		return &cmd.Systemctl{Units: units}, nil
+	case "sysv":
+		return &cmd.SysV{Units: units}, nil
+	default:
+		return nil, fmt.Errorf("unknown service manager %s", manager)
+	}
+}
@@ -1,9 +1,13 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 )
 
 // FpmConfig represent struct for php-fpm configuration files
@@ -12,15 +16,87 @@ type FpmConfig struct {
 	Params  map[string]string
 }
 
-func (f *FpmConfig) Write(path string) {
-	config := fmt.Sprintf("[%s]\n", f.Section)
+// Render returns php-fpm pool configuration, parameters are sorted by name
+func (f *FpmConfig) Render() []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "[%s]\n", f.Section)
 
-	for k, v := range f.Params {
-		config += fmt.Sprintf("%s=%s\n", k, v)
+	keys := make([]string, 0, len(f.Params))
+	for k := range f.Params {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(buf, "%s=%s\n", k, f.Params[k])
+	}
+	return buf.Bytes()
+}
 
-	err := ioutil.WriteFile(path, []byte(config), 0644)
+// FpmListenPort read port from listen parameter of existing php-fpm configuration
+func FpmListenPort(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Fatalln("WriteFile:", err)
+		return 0, err
+	}
+	m := regexp.MustCompile(`(?m)^listen\s*=\s*[\d.]*:(\d+)`).FindSubmatch(data)
+	if m == nil {
+		return 0, fmt.Errorf("listen port not found in %s", path)
+	}
+	return strconv.Atoi(string(m[1]))
+}
+
+// fpmGenerator write php-fpm pool of virtual host, profile fpm-params are
+// added to default parameters
+type fpmGenerator struct{}
+
+func init() {
+	RegisterGenerator("fpm", fpmGenerator{})
+}
+
+func (fpmGenerator) Stage() string {
+	return StageConfigs
+}
+
+func (fpmGenerator) Target(p *Params) Target {
+	return Target{
+		Path: filepath.Join(p.Conf.GetString("fpmdir"), p.RefSlug+".conf"),
+		Mode: 0644,
+		UID:  -1,
+		GID:  -1,
 	}
 }
+
+func (fpmGenerator) Render(p *Params) ([]byte, error) {
+	m := make(map[string]string)
+	m["listen"] = fmt.Sprintf("127.0.0.1:%d", p.Ports[PortPhp])
+	m["user"] = "user"
+	m["pm"] = "static"
+	m["pm.max_children"] = "2"
+	m["pm.max_requests"] = "500"
+	m["request_terminate_timeout"] = "65m"
+	m["php_admin_value[max_execution_time]"] = "300"
+	m["php_admin_value[sendmail_path]"] = "false"
+	for k, v := range p.Profile.FpmParams {
+		m[k] = v
+	}
+
+	fpm := &FpmConfig{
+		Section: p.RefSlug,
+		Params:  m,
+	}
+	return fpm.Render(), nil
+}
+
+func (fpmGenerator) PostWrite(p *Params, t Target) error {
+	return nil
+}
+
+// Service returns php-fpm, new pool is started by reload
+func (fpmGenerator) Service() string {
+	return ServiceFpm
+}
+
+// Validate run php-fpm -t, it checks all pools with new one
+func (fpmGenerator) Validate(p *Params, t Target) error {
+	return ValidateCommand(p.Conf, "fpm", DefaultFpmValidate)
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/cmd"
+	"github.com/antuspenskiy/automate-vhosts/pkg/plan"
+	"github.com/spf13/viper"
+)
+
+// Stages of virtual host setup, every command writes artifacts of its stage
+const (
+	// StageEnv artifacts are written by av-env into new virtual host directory
+	StageEnv = "env"
+	// StageConfigs artifacts are written by av-configs
+	StageConfigs = "configs"
+)
+
+// Params are per virtual host values artifacts are rendered from
+type Params struct {
+	RefSlug    string
+	HostDir    string
+	ServerName string
+	Ports      map[string]int
+	DBName     string
+	DBUser     string
+	DBPassword string
+	Profile    *Profile
+	Conf       *viper.Viper
+	// Changes records services which configuration files are written
+	Changes *cmd.ChangeSet
+}
+
+// Target is a path and permissions of artifact, UID and GID -1 keep owner
+type Target struct {
+	Path string
+	Mode os.FileMode
+	UID  int
+	GID  int
+}
+
+// Generator render configuration file of virtual host
+type Generator interface {
+	// Stage returns command stage which writes artifact
+	Stage() string
+	// Target returns path and permissions of artifact
+	Target(p *Params) Target
+	// Render returns content of artifact
+	Render(p *Params) ([]byte, error)
+	// PostWrite is called after artifact is written
+	PostWrite(p *Params, t Target) error
+}
+
+// Services which configuration files are written by generators
+const (
+	ServiceNginx = "nginx"
+	ServiceFpm   = "php-fpm"
+)
+
+// ServiceConfig is implemented by generators which artifact is configuration
+// of system service, the service is reloaded when artifact is written or removed
+type ServiceConfig interface {
+	// Service returns name of service which reads artifact
+	Service() string
+}
+
+// ArtifactService returns service of artifact by generator name, empty if
+// artifact is not a configuration of service
+func ArtifactService(name string) string {
+	if s, ok := generators[name].(ServiceConfig); ok {
+		return s.Service()
+	}
+	return ""
+}
+
+// Artifact is a result of writing generator output
+type Artifact struct {
+	Name    string
+	Target  Target
+	Created bool
+}
+
+var generators = make(map[string]Generator)
+
+// RegisterGenerator make generator available to profiles by name
+func RegisterGenerator(name string, g Generator) {
+	if _, ok := generators[name]; ok {
+		panic("config: generator registered twice: " + name)
+	}
+	generators[name] = g
+}
+
+// LookupGenerator returns generator registered by name
+func LookupGenerator(name string) (Generator, bool) {
+	g, ok := generators[name]
+	return g, ok
+}
+
+// Generators returns sorted names of registered generators
+func Generators() []string {
+	names := make([]string, 0, len(generators))
+	for name := range generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WriteArtifact render and write artifact, existing file is kept. Artifact of
+// Validator generator is checked before PostWrite, broken file is moved aside
+// and ValidationError is returned then.
+func WriteArtifact(g Generator, p *Params) (Target, bool, error) {
+	t := g.Target(p)
+	if _, err := os.Stat(t.Path); err == nil {
+		return t, false, nil
+	}
+
+	data, err := g.Render(p)
+	if err != nil {
+		return t, false, fmt.Errorf("render %s: %v", t.Path, err)
+	}
+	if !plan.Record(plan.Write, "%s %o, %d bytes", t.Path, t.Mode, len(data)) {
+		if err = ioutil.WriteFile(t.Path, data, t.Mode); err != nil {
+			return t, false, err
+		}
+	}
+	if t.UID >= 0 || t.GID >= 0 {
+		if !plan.Record(plan.Chown, "%s %d:%d", t.Path, t.UID, t.GID) {
+			if err = os.Chown(t.Path, t.UID, t.GID); err != nil {
+				return t, false, err
+			}
+		}
+	}
+	if v, ok := g.(Validator); ok {
+		if err = v.Validate(p, t); err != nil {
+			return t, false, revertArtifact(t.Path, err)
+		}
+	}
+	if s, ok := g.(ServiceConfig); ok {
+		p.Changes.MarkChanged(s.Service())
+	}
+
+	if err = g.PostWrite(p, t); err != nil {
+		return t, true, fmt.Errorf("post write %s: %v", t.Path, err)
+	}
+	return t, true, nil
+}
+
+// GenerateArtifacts write artifacts of profile which belong to stage
+func GenerateArtifacts(stage string, p *Params) ([]Artifact, error) {
+	var artifacts []Artifact
+	for _, name := range p.Profile.Artifacts {
+		g, ok := LookupGenerator(name)
+		if !ok {
+			return artifacts, fmt.Errorf("unknown artifact %s in profile %s", name, p.Profile.Name)
+		}
+		if g.Stage() != stage {
+			continue
+		}
+		// Artifact written before failed PostWrite is returned, so it could be removed
+		t, created, err := WriteArtifact(g, p)
+		if err != nil && !created {
+			return artifacts, err
+		}
+		artifacts = append(artifacts, Artifact{Name: name, Target: t, Created: created})
+		if err != nil {
+			return artifacts, err
+		}
+	}
+	return artifacts, nil
+}
@@ -1,5 +1,9 @@
 package config
 
+import (
+	"path/filepath"
+)
+
 // LaravelTemplate laravel environment configuration
 type LaravelTemplate struct {
 	AppURL       string
@@ -9,8 +13,39 @@ type LaravelTemplate struct {
 	TemplatePath string
 }
 
-// Write used to create laravel environment files for virtual hosts
-func (t *LaravelTemplate) Write(path string) {
-	conf := ParseTemplate(t.TemplatePath, t)
-	WriteToFile(path, conf)
+// Render used to create laravel environment files for virtual hosts
+func (t *LaravelTemplate) Render() ([]byte, error) {
+	return RenderTemplate(t.TemplatePath, t)
+}
+
+// laravelGenerator write .env of Laravel application from server.envtmpl template
+type laravelGenerator struct{}
+
+func init() {
+	RegisterGenerator("laravel", laravelGenerator{})
+}
+
+func (laravelGenerator) Stage() string {
+	return StageEnv
+}
+
+// Target is readable by group of user which runs the application, file keeps
+// database password
+func (laravelGenerator) Target(p *Params) Target {
+	return Target{Path: filepath.Join(p.HostDir, ".env"), Mode: 0640, UID: -1, GID: 1000}
+}
+
+func (laravelGenerator) Render(p *Params) ([]byte, error) {
+	t := &LaravelTemplate{
+		AppURL:       p.RefSlug,
+		DBDatabase:   p.DBName,
+		DBUserName:   p.DBUser,
+		DBPassword:   p.DBPassword,
+		TemplatePath: p.Conf.GetString("server.envtmpl"),
+	}
+	return t.Render()
+}
+
+func (laravelGenerator) PostWrite(p *Params, t Target) error {
+	return nil
 }
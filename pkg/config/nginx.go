@@ -1,16 +1,86 @@
 package config
 
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
 // NginxTemplate represent struct for nginx configuration
 type NginxTemplate struct {
 	ServerName   string
 	PortPhp      int
 	PortNode     int
+	PortExtra    int
 	RefSlug      string
 	TemplatePath string
 }
 
-// Write used to create nginx configuration files for virtual hosts
-func (t *NginxTemplate) Write(path string) {
-	conf := ParseTemplate(t.TemplatePath, t)
-	WriteToFile(path, conf)
+// Render used to create nginx configuration files for virtual hosts
+func (t *NginxTemplate) Render() ([]byte, error) {
+	return RenderTemplate(t.TemplatePath, t)
+}
+
+// NginxPorts read upstream ports of existing nginx configuration, php port of
+// fastcgi_pass and node port of proxy_pass to local address
+func NginxPorts(path string) (map[string]int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ports := make(map[string]int)
+	if m := regexp.MustCompile(`fastcgi_pass\s+(?:127\.0\.0\.1|localhost):(\d+)`).FindSubmatch(data); m != nil {
+		ports[PortPhp], _ = strconv.Atoi(string(m[1]))
+	}
+	if m := regexp.MustCompile(`proxy_pass\s+https?://(?:127\.0\.0\.1|localhost):(\d+)`).FindSubmatch(data); m != nil {
+		ports[PortNode], _ = strconv.Atoi(string(m[1]))
+	}
+	return ports, nil
+}
+
+// nginxGenerator write nginx configuration from server.nginxtmpl template
+type nginxGenerator struct{}
+
+func init() {
+	RegisterGenerator("nginx", nginxGenerator{})
+}
+
+func (nginxGenerator) Stage() string {
+	return StageConfigs
+}
+
+func (nginxGenerator) Target(p *Params) Target {
+	return Target{
+		Path: filepath.Join(p.Conf.GetString("nginxdir"), p.RefSlug+".conf"),
+		Mode: 0644,
+		UID:  -1,
+		GID:  -1,
+	}
+}
+
+func (nginxGenerator) Render(p *Params) ([]byte, error) {
+	t := &NginxTemplate{
+		ServerName:   p.ServerName,
+		PortPhp:      p.Ports[PortPhp],
+		PortNode:     p.Ports[PortNode],
+		PortExtra:    p.Ports[PortExtra],
+		RefSlug:      p.RefSlug,
+		TemplatePath: p.Conf.GetString("server.nginxtmpl"),
+	}
+	return t.Render()
+}
+
+func (nginxGenerator) PostWrite(p *Params, t Target) error {
+	return nil
+}
+
+// Service returns nginx, it is reloaded when configuration is written
+func (nginxGenerator) Service() string {
+	return ServiceNginx
+}
+
+// Validate run nginx -t, it checks all enabled sites with new one
+func (nginxGenerator) Validate(p *Params, t Target) error {
+	return ValidateCommand(p.Conf, "nginx", DefaultNginxValidate)
 }
@@ -1,5 +1,10 @@
 package config
 
+import (
+	"encoding/json"
+	"path/filepath"
+)
+
 // BooksConfig JSON nested configuration for Books
 type BooksConfig struct {
 	Production  BooksConfigNested `json:"production"`
@@ -20,6 +25,36 @@ type BooksConfigNested struct {
 	ExternalServerAPI string   `json:"EXTERNAL_SERVER_API"`
 }
 
-func (p BooksConfig) Write(path string) {
-	WriteJSONToFile(path, p)
+// booksGenerator write env.json of node library, it's needed before deploy commands
+type booksGenerator struct{}
+
+func init() {
+	RegisterGenerator("books", booksGenerator{})
+}
+
+func (booksGenerator) Stage() string {
+	return StageEnv
+}
+
+// Target is readable by group of user which runs the application, file keeps
+// database password
+func (booksGenerator) Target(p *Params) Target {
+	return Target{Path: filepath.Join(p.HostDir, "env.json"), Mode: 0640, UID: -1, GID: 1000}
+}
+
+func (booksGenerator) Render(p *Params) ([]byte, error) {
+	nested := BooksConfigNested{
+		BooksEnv: BooksEnv{
+			BaseName: p.DBName,
+			UserName: p.DBUser,
+			Password: p.DBPassword,
+			Host:     "localhost",
+		},
+		ExternalServerAPI: "https://127.0.0.1",
+	}
+	return json.Marshal(BooksConfig{Production: nested, Development: nested})
+}
+
+func (booksGenerator) PostWrite(p *Params, t Target) error {
+	return nil
 }
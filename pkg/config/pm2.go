@@ -1,8 +1,10 @@
 package config
 
 import (
-	"log"
-	"os"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
 )
 
 // PM2Config represent pm2 struct which contains an array of variables
@@ -28,12 +30,63 @@ type Env struct {
 	NodeEnv string `json:"NODE_ENV"`
 }
 
-// Write create pm2 json configuration and file permissions
-func (p *PM2Config) Write(path string) bool {
-	WriteJSONToFile(path, p)
-	err := os.Chown(path, 1000, 1000)
+// NodeApp returns pm2 application of virtual host
+func NodeApp(p *Params) App {
+	return App{
+		ExecMode: "fork_mode",
+		Script:   "tools/run.js",
+		Args:     []string{"start"},
+		Name:     p.RefSlug,
+		Cwd:      p.HostDir,
+		Env: Env{
+			Port:    p.Ports[PortNode],
+			NodeEnv: "development",
+		},
+		ErrorFile: fmt.Sprintf("log/%s.err.log", p.RefSlug),
+		OutFile:   fmt.Sprintf("log/%s.out.log", p.RefSlug),
+	}
+}
+
+// PM2Port read PORT environment of the first app in existing pm2 configuration
+func PM2Port(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Fatal(err)
+		return 0, err
+	}
+	var p PM2Config
+	if err = json.Unmarshal(data, &p); err != nil {
+		return 0, err
+	}
+	if len(p.Apps) == 0 || p.Apps[0].Env.Port == 0 {
+		return 0, fmt.Errorf("port not found in %s", path)
 	}
-	return err != nil
+	return p.Apps[0].Env.Port, nil
+}
+
+// pm2Generator write pm2 json configuration owned by user which runs pm2
+type pm2Generator struct{}
+
+func init() {
+	RegisterGenerator("pm2", pm2Generator{})
+}
+
+func (pm2Generator) Stage() string {
+	return StageConfigs
+}
+
+func (pm2Generator) Target(p *Params) Target {
+	return Target{
+		Path: filepath.Join(p.Conf.GetString("server.pm2"), p.RefSlug+".json"),
+		Mode: 0644,
+		UID:  1000,
+		GID:  1000,
+	}
+}
+
+func (pm2Generator) Render(p *Params) ([]byte, error) {
+	return json.Marshal(PM2Config{Apps: []App{NodeApp(p)}})
+}
+
+func (pm2Generator) PostWrite(p *Params, t Target) error {
+	return nil
 }
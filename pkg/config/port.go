@@ -1,28 +1,51 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
-	"math/rand"
 	"net"
-	"time"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/plan"
+	"github.com/spf13/viper"
 )
 
+// Services which get a port in the registry
 const (
-	minTCPPort         = 0
-	maxTCPPort         = 9000
-	maxReservedTCPPort = 8080
-	maxRandTCPPort     = maxTCPPort - (maxReservedTCPPort + 1)
+	PortPhp   = "php"
+	PortNode  = "node"
+	PortExtra = "extra"
 )
 
-var (
-	tcpPortRand = rand.New(rand.NewSource(time.Now().UnixNano()))
-)
+// ErrPortOwned is returned when port is allocated for another virtual host
+var ErrPortOwned = errors.New("port is allocated for another virtual host")
+
+// DefaultPortRange used when env.json doesn't declare a range for a service
+var DefaultPortRange = PortRange{Min: 8081, Max: 9000}
+
+// PortRange represent inclusive range of TCP ports for a service
+type PortRange struct {
+	Min int `mapstructure:"min" json:"min"`
+	Max int `mapstructure:"max" json:"max"`
+}
+
+// PortRegistry is a persistent ledger of TCP ports, keyed by refslug and service
+type PortRegistry struct {
+	path   string
+	lock   *os.File
+	ranges map[string]PortRange
+	ports  map[string]map[string]int
+}
 
 // IsTCPPortAvailable returns a flag indicating whether or not a TCP port is
 // available.
 func IsTCPPortAvailable(port int) bool {
-	if port < minTCPPort || port > maxTCPPort {
+	if port < 1 || port > 65535 {
 		return false
 	}
 	conn, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
@@ -38,14 +61,175 @@ func IsTCPPortAvailable(port int) bool {
 	return true
 }
 
-// RandomTCPPort gets a free, random TCP port between 1025-65535. If no free
-// ports are available -1 is returned.
-func RandomTCPPort() int {
-	for i := maxReservedTCPPort; i < maxTCPPort; i++ {
-		p := tcpPortRand.Intn(maxRandTCPPort) + maxReservedTCPPort + 1
-		if IsTCPPortAvailable(p) {
-			return p
+// PortRanges read port ranges from "ports" section of env.json, e.g.
+// "ports": {"php": {"min": 8081, "max": 8500}, "node": {"min": 8501, "max": 9000}}
+func PortRanges(conf *viper.Viper) (map[string]PortRange, error) {
+	ranges := make(map[string]PortRange)
+	if err := conf.UnmarshalKey("ports", &ranges); err != nil {
+		return nil, err
+	}
+	for service, r := range ranges {
+		if r.Min < 1 || r.Max > 65535 || r.Min > r.Max {
+			return nil, fmt.Errorf("invalid port range for %s: %d-%d", service, r.Min, r.Max)
+		}
+	}
+	return ranges, nil
+}
+
+// OpenPortRegistry load port registry from path and lock it until Close
+func OpenPortRegistry(path string, ranges map[string]PortRange) (*PortRegistry, error) {
+	r := &PortRegistry{
+		path:   path,
+		ranges: ranges,
+		ports:  make(map[string]map[string]int),
+	}
+
+	// Registry is read only in dry-run mode, lock file isn't created
+	if !plan.DryRun() {
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			return nil, err
+		}
+		lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+		if err != nil {
+			return nil, err
+		}
+		if err = syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+			lock.Close()
+			return nil, fmt.Errorf("lock port registry %s: %v", path, err)
+		}
+		r.lock = lock
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		r.Close()
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &r.ports); err != nil {
+			r.Close()
+			return nil, fmt.Errorf("parse port registry %s: %v", path, err)
 		}
 	}
-	return -1
+	return r, nil
+}
+
+// OpenPortRegistryFromConfig open registry from "portregistry" path and "ports" ranges of env.json
+func OpenPortRegistryFromConfig(conf *viper.Viper) (*PortRegistry, error) {
+	ranges, err := PortRanges(conf)
+	if err != nil {
+		return nil, err
+	}
+	path := conf.GetString("portregistry")
+	if path == "" {
+		path = "/var/lib/automate-vhosts/ports.json"
+	}
+	return OpenPortRegistry(path, ranges)
+}
+
+// Range returns port range configured for service
+func (r *PortRegistry) Range(service string) PortRange {
+	if pr, ok := r.ranges[service]; ok {
+		return pr
+	}
+	return DefaultPortRange
+}
+
+// Lookup returns port allocated for refslug and service
+func (r *PortRegistry) Lookup(refSlug, service string) (int, bool) {
+	port, ok := r.ports[refSlug][service]
+	return port, ok
+}
+
+// Reserve returns port allocated for refslug and service, the same one on every
+// run. New ports are taken from service range, skipping ports owned by other
+// vhosts and ports which are busy right now.
+func (r *PortRegistry) Reserve(refSlug, service string) (int, error) {
+	if port, ok := r.Lookup(refSlug, service); ok {
+		return port, nil
+	}
+
+	used := make(map[int]bool)
+	for _, services := range r.ports {
+		for _, port := range services {
+			used[port] = true
+		}
+	}
+
+	pr := r.Range(service)
+	for port := pr.Min; port <= pr.Max; port++ {
+		if used[port] || !IsTCPPortAvailable(port) {
+			continue
+		}
+		if err := r.Assign(refSlug, service, port); err != nil {
+			return 0, err
+		}
+		return port, nil
+	}
+	return 0, fmt.Errorf("no free %s port in range %d-%d", service, pr.Min, pr.Max)
+}
+
+// Owner returns refslug and service which port is allocated for
+func (r *PortRegistry) Owner(port int) (string, string, bool) {
+	for refSlug, services := range r.ports {
+		for service, p := range services {
+			if p == port {
+				return refSlug, service, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// Assign record port for refslug and service, used to adopt ports of virtual
+// hosts created before the registry. Returns ErrPortOwned if port is allocated
+// for another refslug or service.
+func (r *PortRegistry) Assign(refSlug, service string, port int) error {
+	if owner, ownerService, ok := r.Owner(port); ok && (owner != refSlug || ownerService != service) {
+		return fmt.Errorf("%w: %s port %d of %s is allocated for %s of %s", ErrPortOwned, service, port, refSlug, ownerService, owner)
+	}
+	if r.ports[refSlug] == nil {
+		r.ports[refSlug] = make(map[string]int)
+	}
+	r.ports[refSlug][service] = port
+	return nil
+}
+
+// Free release port allocated for refslug and service
+func (r *PortRegistry) Free(refSlug, service string) {
+	delete(r.ports[refSlug], service)
+	if len(r.ports[refSlug]) == 0 {
+		delete(r.ports, refSlug)
+	}
+}
+
+// Release free all ports allocated for refslug
+func (r *PortRegistry) Release(refSlug string) {
+	delete(r.ports, refSlug)
+}
+
+// Save write registry to disk, through temporary file and rename
+func (r *PortRegistry) Save() error {
+	data, err := json.MarshalIndent(r.ports, "", " ")
+	if err != nil {
+		return err
+	}
+	if plan.Record(plan.Write, "%s, %d bytes", r.path, len(data)) {
+		return nil
+	}
+	tmp := r.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+// Close release registry lock
+func (r *PortRegistry) Close() error {
+	if r.lock == nil {
+		return nil
+	}
+	err := r.lock.Close()
+	r.lock = nil
+	return err
 }
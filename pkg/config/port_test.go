@@ -0,0 +1,133 @@
+package config
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// freeRange returns range of n ports which are free right now
+func freeRange(t *testing.T, n int) PortRange {
+	t.Helper()
+	for min := 38100; min < 39000; min += n {
+		free := true
+		for port := min; port < min+n; port++ {
+			free = free && IsTCPPortAvailable(port)
+		}
+		if free {
+			return PortRange{Min: min, Max: min + n - 1}
+		}
+	}
+	t.Skip("no free ports")
+	return PortRange{}
+}
+
+func openRegistry(t *testing.T, path string, pr PortRange) *PortRegistry {
+	t.Helper()
+	r, err := OpenPortRegistry(path, map[string]PortRange{PortPhp: pr, PortNode: pr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestPortRegistryReserve(t *testing.T) {
+	pr := freeRange(t, 4)
+	path := filepath.Join(t.TempDir(), "ports.json")
+	r := openRegistry(t, path, pr)
+
+	tests := []struct {
+		refSlug string
+		service string
+		want    int
+	}{
+		{"feature-a", PortPhp, pr.Min},
+		{"feature-a", PortNode, pr.Min + 1},
+		{"feature-b", PortPhp, pr.Min + 2},
+		// The same port on every run
+		{"feature-a", PortPhp, pr.Min},
+		{"feature-b", PortPhp, pr.Min + 2},
+	}
+	for _, tt := range tests {
+		port, err := r.Reserve(tt.refSlug, tt.service)
+		if err != nil {
+			t.Fatalf("Reserve(%s, %s): %v", tt.refSlug, tt.service, err)
+		}
+		if port != tt.want {
+			t.Errorf("Reserve(%s, %s) = %d, want %d", tt.refSlug, tt.service, port, tt.want)
+		}
+	}
+
+	// Busy port is skipped
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	busy := l.Addr().(*net.TCPAddr).Port
+	busyRegistry := openRegistry(t, filepath.Join(t.TempDir(), "ports.json"), PortRange{Min: busy, Max: busy})
+	if port, err := busyRegistry.Reserve("feature-c", PortPhp); err == nil {
+		t.Errorf("Reserve of busy port %d = %d, want error", busy, port)
+	}
+
+	// Range is exhausted
+	if _, err = r.Reserve("feature-c", PortPhp); err != nil {
+		t.Fatal(err)
+	}
+	if port, err := r.Reserve("feature-d", PortPhp); err == nil {
+		t.Errorf("Reserve in exhausted range = %d, want error", port)
+	}
+
+	// Ports are kept after registry is saved and opened again
+	if err = r.Save(); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	r = openRegistry(t, path, pr)
+	if port, ok := r.Lookup("feature-b", PortPhp); !ok || port != pr.Min+2 {
+		t.Errorf("Lookup(feature-b, php) after reopen = %d, %v, want %d", port, ok, pr.Min+2)
+	}
+
+	// Freed port is reserved again
+	r.Free("feature-a", PortNode)
+	if port, err := r.Reserve("feature-d", PortPhp); err != nil || port != pr.Min+1 {
+		t.Errorf("Reserve after Free = %d, %v, want %d", port, err, pr.Min+1)
+	}
+	r.Release("feature-b")
+	if _, ok := r.Lookup("feature-b", PortPhp); ok {
+		t.Errorf("Lookup(feature-b, php) after Release is found")
+	}
+}
+
+func TestPortRegistryAssign(t *testing.T) {
+	r := openRegistry(t, filepath.Join(t.TempDir(), "ports.json"), DefaultPortRange)
+	if err := r.Assign("feature-a", PortPhp, 8081); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		refSlug string
+		service string
+		port    int
+		err     error
+	}{
+		{"the same port again", "feature-a", PortPhp, 8081, nil},
+		{"another port", "feature-a", PortNode, 8082, nil},
+		{"port of another refslug", "feature-b", PortPhp, 8081, ErrPortOwned},
+		{"port of another service", "feature-a", PortNode, 8081, ErrPortOwned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.Assign(tt.refSlug, tt.service, tt.port)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Assign(%s, %s, %d) = %v, want %v", tt.refSlug, tt.service, tt.port, err, tt.err)
+			}
+		})
+	}
+	if port, _ := r.Lookup("feature-b", PortPhp); port != 0 {
+		t.Errorf("conflicting port is assigned to feature-b: %d", port)
+	}
+}
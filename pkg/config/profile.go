@@ -0,0 +1,165 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/cmd"
+	"github.com/antuspenskiy/automate-vhosts/pkg/db"
+	"github.com/spf13/viper"
+)
+
+// Profile describe which artifacts, services and steps apply to virtual hosts
+// of a project. Profiles are declared in "profiles" section of env.json.
+type Profile struct {
+	Name string `mapstructure:"-"`
+	// MatchHostname is optional fallback rule, profile is selected when server
+	// hostname contains one of these strings
+	MatchHostname []string `mapstructure:"match-hostname"`
+	// Artifacts are configuration files: nginx, fpm, pm2, books, laravel
+	Artifacts []string `mapstructure:"artifacts"`
+	// Services which get a port: php, node and extra, an additional upstream
+	// of nginx template like websocket server
+	Services []string `mapstructure:"services"`
+	// PostImport steps after database import: anonymize
+	PostImport []string `mapstructure:"post-import"`
+	// PostDeploy steps after checkout and deploy commands: bitrix-settings
+	PostDeploy []string `mapstructure:"post-deploy"`
+	// FpmParams are added to php-fpm pool configuration
+	FpmParams map[string]string `mapstructure:"fpm-params"`
+	// Anonymize rules applied by anonymize step
+	Anonymize []db.AnonymizeRule `mapstructure:"anonymize"`
+	// Deploy steps run after checkout, see DeploySteps
+	Deploy []cmd.Step `mapstructure:"deploy"`
+}
+
+// builtinProfiles keep behaviour of servers which env.json has no profiles
+var builtinProfiles = map[string]Profile{
+	"intranet": {
+		MatchHostname: []string{"intranet"},
+		Artifacts:     []string{"nginx", "fpm", "pm2", "books"},
+		Services:      []string{PortPhp, PortNode},
+		PostDeploy:    []string{"bitrix-settings"},
+		FpmParams:     map[string]string{"php_admin_value[mbstring.func_overload]": "4"},
+	},
+	"ees": {
+		MatchHostname: []string{"ees"},
+		Artifacts:     []string{"nginx", "fpm", "laravel"},
+		Services:      []string{PortPhp},
+		PostImport:    []string{"anonymize"},
+		Anonymize: []db.AnonymizeRule{
+			{Table: "user_data", Column: "salary", Strategy: db.StrategyFixed, Value: "10000"},
+			{Table: "user_data", Column: "salary_proposed", Strategy: db.StrategyFixed, Value: "11000"},
+		},
+	},
+}
+
+// HasArtifact returns true if profile generates artifact
+func (p *Profile) HasArtifact(name string) bool {
+	return contains(p.Artifacts, name)
+}
+
+// HasService returns true if profile runs service
+func (p *Profile) HasService(name string) bool {
+	return contains(p.Services, name)
+}
+
+// HasPostImport returns true if step runs after database import
+func (p *Profile) HasPostImport(name string) bool {
+	return contains(p.PostImport, name)
+}
+
+// HasPostDeploy returns true if step runs after deploy
+func (p *Profile) HasPostDeploy(name string) bool {
+	return contains(p.PostDeploy, name)
+}
+
+// DeploySteps returns deploy steps of profile. Servers without structured
+// steps run comma separated "server.cmd-dir-not-exist" commands on create and
+// "server.cmd-dir-exist" commands on update.
+func DeploySteps(conf *viper.Viper, p *Profile) []cmd.Step {
+	if len(p.Deploy) > 0 {
+		return p.Deploy
+	}
+	steps := cmd.ShellSteps(conf.GetString("server.cmd-dir-not-exist"), cmd.WhenCreate)
+	return append(steps, cmd.ShellSteps(conf.GetString("server.cmd-dir-exist"), cmd.WhenUpdate)...)
+}
+
+// LoadProfile returns profile by name, from env.json or builtin one
+func LoadProfile(conf *viper.Viper, name string) (*Profile, error) {
+	p := &Profile{}
+	key := "profiles." + name
+	if conf.IsSet(key) {
+		if err := conf.UnmarshalKey(key, p); err != nil {
+			return nil, fmt.Errorf("parse profile %s: %v", name, err)
+		}
+	} else if builtin, ok := builtinProfiles[name]; ok {
+		*p = builtin
+		// Top level rules replace rules of builtin profile
+		if conf.IsSet("anonymize") {
+			p.Anonymize = nil
+		}
+	} else {
+		return nil, fmt.Errorf("profile %s not found", name)
+	}
+	p.Name = name
+
+	// Rules declared before profiles are in top level "anonymize" section
+	if len(p.Anonymize) == 0 {
+		if err := conf.UnmarshalKey("anonymize", &p.Anonymize); err != nil {
+			return nil, err
+		}
+	}
+	// Steps shared by profiles are in top level "deploy" section
+	if len(p.Deploy) == 0 {
+		if err := conf.UnmarshalKey("deploy", &p.Deploy); err != nil {
+			return nil, fmt.Errorf("parse deploy steps: %v", err)
+		}
+	}
+	return p, nil
+}
+
+// SelectProfile returns profile set by flag, by "profile" key of env.json or,
+// as a fallback, the first profile which hostname rule matches server
+func SelectProfile(conf *viper.Viper, name string, hostname string) (*Profile, error) {
+	if name == "" {
+		name = conf.GetString("profile")
+	}
+	if name != "" {
+		return LoadProfile(conf, name)
+	}
+
+	names := make([]string, 0)
+	for n := range conf.GetStringMap("profiles") {
+		names = append(names, n)
+	}
+	for n := range builtinProfiles {
+		if !conf.IsSet("profiles." + n) {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		p, err := LoadProfile(conf, n)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range p.MatchHostname {
+			if match != "" && strings.Contains(hostname, match) {
+				return p, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no profile matches hostname %s, set -profile flag or profile in env.json", hostname)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
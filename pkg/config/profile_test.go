@@ -0,0 +1,84 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/db"
+	"github.com/spf13/viper"
+)
+
+func TestBuiltinProfiles(t *testing.T) {
+	tests := []struct {
+		hostname   string
+		name       string
+		artifacts  []string
+		services   []string
+		postImport []string
+		postDeploy []string
+		anonymize  []db.AnonymizeRule
+	}{
+		{
+			hostname:   "intranet-dev01",
+			name:       "intranet",
+			artifacts:  []string{"nginx", "fpm", "pm2", "books"},
+			services:   []string{PortPhp, PortNode},
+			postDeploy: []string{"bitrix-settings"},
+		},
+		{
+			hostname:   "ees-dev01",
+			name:       "ees",
+			artifacts:  []string{"nginx", "fpm", "laravel"},
+			services:   []string{PortPhp},
+			postImport: []string{"anonymize"},
+			anonymize: []db.AnonymizeRule{
+				{Table: "user_data", Column: "salary", Strategy: db.StrategyFixed, Value: "10000"},
+				{Table: "user_data", Column: "salary_proposed", Strategy: db.StrategyFixed, Value: "11000"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// env.json without profiles
+			p, err := SelectProfile(viper.New(), "", tt.hostname)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Name != tt.name {
+				t.Fatalf("profile of %s = %s, want %s", tt.hostname, p.Name, tt.name)
+			}
+			if !reflect.DeepEqual(p.Artifacts, tt.artifacts) {
+				t.Errorf("artifacts = %q, want %q", p.Artifacts, tt.artifacts)
+			}
+			if !reflect.DeepEqual(p.Services, tt.services) {
+				t.Errorf("services = %q, want %q", p.Services, tt.services)
+			}
+			if !reflect.DeepEqual(p.PostImport, tt.postImport) {
+				t.Errorf("post-import = %q, want %q", p.PostImport, tt.postImport)
+			}
+			if !reflect.DeepEqual(p.PostDeploy, tt.postDeploy) {
+				t.Errorf("post-deploy = %q, want %q", p.PostDeploy, tt.postDeploy)
+			}
+			if !reflect.DeepEqual(p.Anonymize, tt.anonymize) {
+				t.Errorf("anonymize = %v, want %v", p.Anonymize, tt.anonymize)
+			}
+		})
+	}
+}
+
+func TestBuiltinProfileTopLevelAnonymize(t *testing.T) {
+	conf := viper.New()
+	rules := []db.AnonymizeRule{{Table: "users", Column: "email", Strategy: db.StrategyEmail}}
+	conf.Set("anonymize", []map[string]interface{}{{"table": "users", "column": "email", "strategy": db.StrategyEmail}})
+
+	p, err := LoadProfile(conf, "ees")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p.Anonymize, rules) {
+		t.Errorf("anonymize = %v, want %v", p.Anonymize, rules)
+	}
+	if len(builtinProfiles["ees"].Anonymize) != 2 {
+		t.Errorf("rules of builtin profile are changed: %v", builtinProfiles["ees"].Anonymize)
+	}
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/cmd"
+	"github.com/spf13/viper"
+)
+
+// Defaults of systemd unit backend, they are changed by "server" section of
+// env.json: "systemd" directory of units, "node" binary and "node-user"
+const (
+	DefaultSystemdDir = "/etc/systemd/system"
+	DefaultNode       = "/usr/bin/node"
+	DefaultNodeUser   = "user"
+)
+
+// UnitName returns systemd service name of virtual host node application
+func UnitName(refSlug string) string {
+	return "av-" + refSlug
+}
+
+// UnitPath returns path of virtual host systemd unit
+func UnitPath(conf *viper.Viper, refSlug string) string {
+	dir := conf.GetString("server.systemd")
+	if dir == "" {
+		dir = DefaultSystemdDir
+	}
+	return filepath.Join(dir, UnitName(refSlug)+".service")
+}
+
+// appendSince is the first systemd version which appends output to files,
+// CentOS 7 ships systemd 219
+const appendSince = 240
+
+// SystemdUnit is a systemd service which runs node application like pm2 does
+type SystemdUnit struct {
+	App  App
+	Node string
+	User string
+	// Version of systemd, output goes to log files of App since version 240,
+	// to journal before it
+	Version int
+}
+
+// Render returns content of systemd unit file
+func (u *SystemdUnit) Render() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "[Unit]\n")
+	fmt.Fprintf(&b, "Description=Node application of virtual host %s\n", u.App.Name)
+	fmt.Fprintf(&b, "After=network.target\n\n")
+
+	fmt.Fprintf(&b, "[Service]\n")
+	fmt.Fprintf(&b, "Type=simple\n")
+	fmt.Fprintf(&b, "User=%s\n", u.User)
+	fmt.Fprintf(&b, "WorkingDirectory=%s\n", u.App.Cwd)
+	fmt.Fprintf(&b, "Environment=PORT=%d\n", u.App.Env.Port)
+	fmt.Fprintf(&b, "Environment=NODE_ENV=%s\n", u.App.Env.NodeEnv)
+	args := append([]string{u.Node, u.App.Script}, u.App.Args...)
+	for i := range args {
+		args[i] = execArg(args[i])
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(args, " "))
+	fmt.Fprintf(&b, "Restart=on-failure\n")
+	if u.Version >= appendSince {
+		// Log files of pm2 configuration are relative to working directory
+		fmt.Fprintf(&b, "StandardOutput=append:%s\n", u.logPath(u.App.OutFile))
+		fmt.Fprintf(&b, "StandardError=append:%s\n\n", u.logPath(u.App.ErrorFile))
+	} else {
+		fmt.Fprintf(&b, "StandardOutput=journal\n")
+		fmt.Fprintf(&b, "StandardError=journal\n\n")
+	}
+
+	fmt.Fprintf(&b, "[Install]\n")
+	fmt.Fprintf(&b, "WantedBy=multi-user.target\n")
+	return b.Bytes()
+}
+
+func (u *SystemdUnit) logPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(u.App.Cwd, path)
+}
+
+// execArg quote argument of ExecStart: "%" specifiers and "$" variables are
+// escaped, argument with spaces, quotes, backslashes or ";" is double quoted
+func execArg(arg string) string {
+	arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\;") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`).Replace(arg) + `"`
+}
+
+// SystemdVersion returns version of systemd from systemctl --version, it is
+// run in dry-run mode too
+func SystemdVersion() (int, error) {
+	out, err := exec.Command("systemctl", "--version").Output()
+	if err != nil {
+		return 0, err
+	}
+	// The first line is like "systemd 219"
+	fields := strings.Fields(string(out))
+	if len(fields) < 2 || fields[0] != "systemd" {
+		return 0, fmt.Errorf("unknown systemctl version %q", strings.SplitN(string(out), "\n", 2)[0])
+	}
+	return strconv.Atoi(fields[1])
+}
+
+// SystemdPort read PORT environment of existing systemd unit
+func SystemdPort(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "Environment=PORT=") {
+			return strconv.Atoi(strings.TrimPrefix(line, "Environment=PORT="))
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("port not found in %s", path)
+}
+
+// StartUnit reload systemd units, then enable and start new unit or restart
+// existing one
+func StartUnit(ctx context.Context, unit string, created bool) error {
+	if err := cmd.ExecContext(ctx, "", "systemctl", "daemon-reload"); err != nil {
+		return err
+	}
+	if created {
+		return cmd.ExecContext(ctx, "", "systemctl", "enable", "--now", unit)
+	}
+	return cmd.ExecContext(ctx, "", "systemctl", "restart", unit)
+}
+
+// StopUnit stop and disable unit, failure is only logged, unit may be not
+// loaded already
+func StopUnit(ctx context.Context, unit string) error {
+	if err := cmd.ExecContext(ctx, "", "systemctl", "disable", "--now", unit); err != nil {
+		log.Printf("Stop unit %s: %v\n", unit, err)
+	}
+	return nil
+}
+
+// systemdGenerator write systemd unit of node application, alternative to pm2
+// for servers without pm2
+type systemdGenerator struct{}
+
+func init() {
+	RegisterGenerator("systemd", systemdGenerator{})
+}
+
+func (systemdGenerator) Stage() string {
+	return StageConfigs
+}
+
+func (systemdGenerator) Target(p *Params) Target {
+	return Target{
+		Path: UnitPath(p.Conf, p.RefSlug),
+		Mode: 0644,
+		UID:  -1,
+		GID:  -1,
+	}
+}
+
+func (systemdGenerator) Render(p *Params) ([]byte, error) {
+	u := &SystemdUnit{
+		App:  NodeApp(p),
+		Node: p.Conf.GetString("server.node"),
+		User: p.Conf.GetString("server.node-user"),
+	}
+	if u.Node == "" {
+		u.Node = DefaultNode
+	}
+	if u.User == "" {
+		u.User = DefaultNodeUser
+	}
+	// Version is detected unless "server.systemd-version" is set, unknown
+	// version logs to journal
+	if u.Version = p.Conf.GetInt("server.systemd-version"); u.Version == 0 {
+		version, err := SystemdVersion()
+		if err != nil {
+			log.Printf("systemd version: %v\n", err)
+		}
+		u.Version = version
+	}
+	return u.Render(), nil
+}
+
+func (systemdGenerator) PostWrite(p *Params, t Target) error {
+	return nil
+}
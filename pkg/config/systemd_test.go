@@ -0,0 +1,72 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecArg(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"/usr/bin/node", "/usr/bin/node"},
+		{"tools/run.js", "tools/run.js"},
+		{"--port=8081", "--port=8081"},
+		{"", `""`},
+		{"100%", "100%%"},
+		{"$HOME", "$$HOME"},
+		{"two words", `"two words"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`C:\dir`, `"C:\\dir"`},
+		{"a;b", `"a;b"`},
+		{"it's", `"it's"`},
+		{"tab\there", `"tab\there"`},
+		{"50% $off", `"50%% $$off"`},
+	}
+	for _, tt := range tests {
+		if got := execArg(tt.in); got != tt.want {
+			t.Errorf("execArg(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSystemdUnitRender(t *testing.T) {
+	app := App{
+		Script:    "tools/run.js",
+		Args:      []string{"start", "--name", "my app"},
+		Name:      "feature-a",
+		Cwd:       "/var/web/feature-a",
+		Env:       Env{Port: 8082, NodeEnv: "production"},
+		ErrorFile: "logs/err.log",
+		OutFile:   "/var/log/out.log",
+	}
+	tests := []struct {
+		version int
+		want    []string
+	}{
+		{219, []string{"StandardOutput=journal\n", "StandardError=journal\n"}},
+		{240, []string{"StandardOutput=append:/var/log/out.log\n", "StandardError=append:/var/web/feature-a/logs/err.log\n"}},
+	}
+	for _, tt := range tests {
+		u := &SystemdUnit{App: app, Node: DefaultNode, User: DefaultNodeUser, Version: tt.version}
+		unit := string(u.Render())
+		want := append(tt.want, `ExecStart=/usr/bin/node tools/run.js start --name "my app"`+"\n")
+		for _, line := range want {
+			if !strings.Contains(unit, line) {
+				t.Errorf("unit of systemd %d doesn't contain %q:\n%s", tt.version, line, unit)
+			}
+		}
+
+		// Port is read back from unit file
+		path := filepath.Join(t.TempDir(), "av-feature-a.service")
+		if err := ioutil.WriteFile(path, []byte(unit), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if port, err := SystemdPort(path); err != nil || port != app.Env.Port {
+			t.Errorf("SystemdPort = %d, %v, want %d", port, err, app.Env.Port)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/cmd"
+	"github.com/antuspenskiy/automate-vhosts/pkg/plan"
+	"github.com/spf13/viper"
+)
+
+// Default commands which check configuration of services, they are changed by
+// "validate" section of env.json, like "validate": {"fpm": "php-fpm7.4 -t"}
+const (
+	DefaultNginxValidate = "nginx -t"
+	DefaultFpmValidate   = "php-fpm -t"
+)
+
+// Validator is implemented by generators which artifact is checked before
+// services are reloaded
+type Validator interface {
+	// Validate returns error with validator output if written artifact is broken
+	Validate(p *Params, t Target) error
+}
+
+// ValidationError is returned when written artifact fails validation. Broken
+// file is moved aside to Aside.
+type ValidationError struct {
+	Path  string
+	Aside string
+	Err   error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("validate %s: %v\nbroken file is moved to %s", e.Path, e.Err, e.Aside)
+}
+
+// Unwrap returns error of validator
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateCommand run validator of service from "validate" section of env.json
+// or default command
+func ValidateCommand(conf *viper.Viper, service string, def string) error {
+	command := conf.GetString("validate." + service)
+	if command == "" {
+		command = def
+	}
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return fmt.Errorf("validate command of %s is empty", service)
+	}
+	return cmd.Exec(args[0], args[1:]...)
+}
+
+// revertArtifact move broken artifact aside, so the next run writes it again
+func revertArtifact(path string, err error) error {
+	e := &ValidationError{Path: path, Aside: path + ".invalid", Err: err}
+	if rerr := rename(path, e.Aside); rerr != nil {
+		return fmt.Errorf("%v, move aside: %v", e, rerr)
+	}
+	return e
+}
+
+// rename move file, in dry-run mode it is only added to plan
+func rename(from, to string) error {
+	if plan.Record(plan.Rename, "%s to %s", from, to) {
+		return nil
+	}
+	return os.Rename(from, to)
+}
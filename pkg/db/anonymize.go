@@ -0,0 +1,127 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/plan"
+)
+
+// Anonymization strategies
+const (
+	StrategyFixed    = "fixed"
+	StrategyName     = "fake_name"
+	StrategyEmail    = "fake_email"
+	StrategyPhone    = "fake_phone"
+	StrategyHash     = "hash"
+	StrategyNull     = "null"
+	StrategyTruncate = "truncate"
+)
+
+// AnonymizeRule describe how to anonymize column of table, rules are declared
+// in "anonymize" section of env.json
+type AnonymizeRule struct {
+	Table    string `mapstructure:"table"`
+	Column   string `mapstructure:"column"`
+	Strategy string `mapstructure:"strategy"`
+	// Value for fixed strategy
+	Value string `mapstructure:"value"`
+	// Where is optional SQL condition limiting rows
+	Where string `mapstructure:"where"`
+}
+
+func (r AnonymizeRule) String() string {
+	if r.Strategy == StrategyTruncate {
+		return fmt.Sprintf("%s: %s", r.Table, r.Strategy)
+	}
+	return fmt.Sprintf("%s.%s: %s", r.Table, r.Column, r.Strategy)
+}
+
+// Query returns SQL statement and arguments for rule. Fake values are derived
+// from original value, so equal values stay equal after anonymization.
+func (r AnonymizeRule) Query(dbname string) (string, []interface{}, error) {
+	if r.Table == "" {
+		return "", nil, fmt.Errorf("anonymize rule without table")
+	}
+	table := quoteIdent(dbname) + "." + quoteIdent(r.Table)
+	// DELETE instead of TRUNCATE TABLE reports deleted rows, keeps where
+	// condition and works on tables referenced by foreign keys
+	if r.Strategy == StrategyTruncate {
+		query := fmt.Sprintf("DELETE FROM %s", table)
+		if r.Where != "" {
+			query += fmt.Sprintf(" WHERE %s", r.Where)
+		}
+		return query, nil, nil
+	}
+	if r.Column == "" {
+		return "", nil, fmt.Errorf("anonymize rule %s without column", r.Table)
+	}
+
+	col := quoteIdent(r.Column)
+	var (
+		expr string
+		args []interface{}
+	)
+	switch r.Strategy {
+	case StrategyFixed:
+		expr = "?"
+		args = append(args, r.Value)
+	case StrategyName:
+		expr = fmt.Sprintf("CONCAT('User ', UPPER(LEFT(SHA2(%s, 256), 8)))", col)
+	case StrategyEmail:
+		expr = fmt.Sprintf("CONCAT('user_', LEFT(SHA2(%s, 256), 12), '@example.com')", col)
+	case StrategyPhone:
+		expr = fmt.Sprintf("CONCAT('+7900', LPAD(CRC32(%s) %% 10000000, 7, '0'))", col)
+	case StrategyHash:
+		expr = fmt.Sprintf("SHA2(%s, 256)", col)
+	case StrategyNull:
+		expr = "NULL"
+	default:
+		return "", nil, fmt.Errorf("unknown anonymize strategy %q for %s", r.Strategy, r)
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s = %s", table, col, expr)
+	// NULL stays NULL, fake values are generated only for existing data
+	if r.Strategy != StrategyFixed && r.Strategy != StrategyNull {
+		query += fmt.Sprintf(" WHERE %s IS NOT NULL", col)
+		if r.Where != "" {
+			query += fmt.Sprintf(" AND (%s)", r.Where)
+		}
+	} else if r.Where != "" {
+		query += fmt.Sprintf(" WHERE %s", r.Where)
+	}
+	return query, args, nil
+}
+
+// AnonymizeResult is a number of rows affected by rule
+type AnonymizeResult struct {
+	Rule         AnonymizeRule
+	RowsAffected int64
+}
+
+// Anonymize apply rules to database one by one and returns rows affected per rule
+func Anonymize(db *sql.DB, dbname string, rules []AnonymizeRule) ([]AnonymizeResult, error) {
+	results := make([]AnonymizeResult, 0, len(rules))
+	for _, rule := range rules {
+		rule.Strategy = strings.ToLower(rule.Strategy)
+		query, args, err := rule.Query(dbname)
+		if err != nil {
+			return results, err
+		}
+		if plan.Record(plan.SQL, "%s %v", query, args) {
+			results = append(results, AnonymizeResult{Rule: rule})
+			continue
+		}
+		res, err := db.Exec(query, args...)
+		if err != nil {
+			return results, fmt.Errorf("anonymize %s: %v", rule, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return results, err
+		}
+		results = append(results, AnonymizeResult{Rule: rule, RowsAffected: n})
+	}
+	return results, nil
+}
@@ -0,0 +1,465 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// defaultInsertSize is a size of extended INSERT statement in bytes, it keeps
+// statements below default max_allowed_packet
+const defaultInsertSize = 1 << 20
+
+// Snapshot is a transaction with consistent snapshot on a single connection.
+// Dumps of several databases read through one snapshot are consistent with
+// each other. TIMESTAMP values are read in UTC.
+type Snapshot struct {
+	conn *sql.Conn
+}
+
+// BeginSnapshot start transaction with consistent snapshot, it is rolled back
+// by Close
+func BeginSnapshot(ctx context.Context, db *sql.DB) (*Snapshot, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, query := range []string{
+		"SET SESSION TIME_ZONE = '+00:00'",
+		"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+		"START TRANSACTION WITH CONSISTENT SNAPSHOT",
+	} {
+		if _, err = conn.ExecContext(ctx, query); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return &Snapshot{conn: conn}, nil
+}
+
+// Close roll back transaction and close connection
+func (s *Snapshot) Close() error {
+	s.conn.ExecContext(context.Background(), "ROLLBACK")
+	return s.conn.Close()
+}
+
+// Dumper dump MySQL database as SQL statements: tables with rows, triggers,
+// stored procedures and functions, and views. Schema and data are read in a
+// single transaction with consistent snapshot.
+type Dumper struct {
+	DB *sql.DB
+	// Snapshot is shared by dumps of several databases, a new one is started
+	// on DB if nil
+	Snapshot *Snapshot
+	Database string
+	// Tables to dump, all tables if empty
+	Tables []string
+	// ExcludeTables are skipped completely
+	ExcludeTables []string
+	// NoDataTables are dumped without rows, e.g. huge log tables
+	NoDataTables []string
+	// InsertSize limit size of extended INSERT statement, defaultInsertSize if zero
+	InsertSize int
+}
+
+type dumpTable struct {
+	name string
+	view bool
+}
+
+var definerRegexp = regexp.MustCompile(`DEFINER=\S+@\S+ `)
+
+// dumpMode is SQL mode of dump statements
+const dumpMode = "NO_AUTO_VALUE_ON_ZERO"
+
+// Dump write SQL statements of database to w
+func (d *Dumper) Dump(ctx context.Context, w io.Writer) error {
+	snapshot := d.Snapshot
+	if snapshot == nil {
+		var err error
+		if snapshot, err = BeginSnapshot(ctx, d.DB); err != nil {
+			return err
+		}
+		defer snapshot.Close()
+	}
+	conn := snapshot.conn
+
+	tables, err := d.tables(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriterSize(w, 64*1024)
+	fmt.Fprintf(bw, "-- Dump of database %s, %s\n\n", d.Database, time.Now().Format(time.RFC3339))
+	fmt.Fprint(bw, "SET NAMES utf8mb4;\n")
+	// TIMESTAMP values are dumped in UTC, they don't shift between servers
+	fmt.Fprint(bw, "SET TIME_ZONE='+00:00';\n")
+	fmt.Fprint(bw, "SET FOREIGN_KEY_CHECKS=0;\n")
+	fmt.Fprint(bw, "SET UNIQUE_CHECKS=0;\n")
+	fmt.Fprintf(bw, "SET SQL_MODE='%s';\n\n", dumpMode)
+
+	// Triggers are created after rows are inserted, so they don't fire.
+	// Views may call functions, create them at the end.
+	for _, t := range tables {
+		if t.view {
+			continue
+		}
+		if err = d.dumpTable(ctx, conn, bw, t.name); err != nil {
+			return fmt.Errorf("dump table %s: %v", t.name, err)
+		}
+		if err = d.dumpTriggers(ctx, conn, bw, t.name); err != nil {
+			return fmt.Errorf("dump triggers of %s: %v", t.name, err)
+		}
+	}
+	if err = d.dumpRoutines(ctx, conn, bw); err != nil {
+		return fmt.Errorf("dump routines: %v", err)
+	}
+	for _, t := range tables {
+		if !t.view {
+			continue
+		}
+		if err = d.dumpView(ctx, conn, bw, t.name); err != nil {
+			return fmt.Errorf("dump view %s: %v", t.name, err)
+		}
+	}
+
+	fmt.Fprint(bw, "SET FOREIGN_KEY_CHECKS=1;\n")
+	fmt.Fprint(bw, "SET UNIQUE_CHECKS=1;\n")
+	return bw.Flush()
+}
+
+// tables returns tables and views of database filtered by Tables and ExcludeTables
+func (d *Dumper) tables(ctx context.Context, conn *sql.Conn) ([]dumpTable, error) {
+	rows, err := conn.QueryContext(ctx,
+		"SELECT TABLE_NAME, TABLE_TYPE FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME",
+		d.Database)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []dumpTable
+	for rows.Next() {
+		var name, kind string
+		if err = rows.Scan(&name, &kind); err != nil {
+			return nil, err
+		}
+		if len(d.Tables) > 0 && !contains(d.Tables, name) {
+			continue
+		}
+		if contains(d.ExcludeTables, name) {
+			continue
+		}
+		tables = append(tables, dumpTable{name: name, view: kind == "VIEW"})
+	}
+	return tables, rows.Err()
+}
+
+// columns returns columns of table which rows are dumped, generated columns
+// are computed by server and can't be inserted
+func (d *Dumper) columns(ctx context.Context, conn *sql.Conn, table string) ([]string, error) {
+	rows, err := conn.QueryContext(ctx,
+		"SELECT COLUMN_NAME, EXTRA FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION",
+		d.Database, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var name, extra string
+		if err = rows.Scan(&name, &extra); err != nil {
+			return nil, err
+		}
+		if !generatedColumn(extra) {
+			columns = append(columns, quoteIdent(name))
+		}
+	}
+	return columns, rows.Err()
+}
+
+// generatedColumn returns true if EXTRA of information_schema.COLUMNS is of
+// generated column: "VIRTUAL GENERATED", "STORED GENERATED" or MariaDB
+// "PERSISTENT GENERATED". Columns with default expression, "DEFAULT_GENERATED"
+// of MySQL 8, are not generated.
+func generatedColumn(extra string) bool {
+	for _, field := range strings.Fields(strings.ToUpper(extra)) {
+		switch field {
+		case "VIRTUAL", "STORED", "PERSISTENT":
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Dumper) dumpTable(ctx context.Context, conn *sql.Conn, w *bufio.Writer, table string) error {
+	var name, create string
+	err := conn.QueryRowContext(ctx, fmt.Sprintf("SHOW CREATE TABLE %s.%s", quoteIdent(d.Database), quoteIdent(table))).Scan(&name, &create)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "--\n-- Table structure for %s\n--\n\n", table)
+	fmt.Fprintf(w, "DROP TABLE IF EXISTS %s;\n%s;\n\n", quoteIdent(table), create)
+
+	if contains(d.NoDataTables, table) {
+		log.Printf("Dump table %s: schema only\n", table)
+		return nil
+	}
+
+	names, err := d.columns(ctx, conn, table)
+	if err != nil {
+		return err
+	}
+	list := strings.Join(names, ",")
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s.%s", list, quoteIdent(d.Database), quoteIdent(table)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	limit := d.InsertSize
+	if limit <= 0 {
+		limit = defaultInsertSize
+	}
+
+	var (
+		stmt  strings.Builder
+		count int
+	)
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", quoteIdent(table), list)
+	flush := func() {
+		if stmt.Len() > 0 {
+			w.WriteString(stmt.String())
+			w.WriteString(";\n")
+			stmt.Reset()
+		}
+	}
+
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return err
+		}
+		if stmt.Len() == 0 {
+			stmt.WriteString(prefix)
+		} else {
+			stmt.WriteString(",")
+		}
+		stmt.WriteString("(")
+		for i, v := range values {
+			if i > 0 {
+				stmt.WriteString(",")
+			}
+			stmt.WriteString(sqlValue(v, columns[i].DatabaseTypeName()))
+		}
+		stmt.WriteString(")")
+		count++
+
+		if stmt.Len() >= limit {
+			flush()
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	flush()
+	fmt.Fprint(w, "\n")
+	log.Printf("Dump table %s: %d rows\n", table, count)
+	return nil
+}
+
+func (d *Dumper) dumpView(ctx context.Context, conn *sql.Conn, w *bufio.Writer, view string) error {
+	var name, create, charset, collation string
+	err := conn.QueryRowContext(ctx, fmt.Sprintf("SHOW CREATE VIEW %s.%s", quoteIdent(d.Database), quoteIdent(view))).Scan(&name, &create, &charset, &collation)
+	if err != nil {
+		return err
+	}
+	// Definer user doesn't exist on review servers
+	create = definerRegexp.ReplaceAllString(create, "")
+	fmt.Fprintf(w, "--\n-- View %s\n--\n\n", view)
+	fmt.Fprintf(w, "DROP VIEW IF EXISTS %s;\n%s;\n\n", quoteIdent(view), create)
+	return nil
+}
+
+// dumpTriggers write triggers of table
+func (d *Dumper) dumpTriggers(ctx context.Context, conn *sql.Conn, w *bufio.Writer, table string) error {
+	triggers, err := queryNames(ctx, conn,
+		"SELECT TRIGGER_NAME FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA = ? AND EVENT_OBJECT_TABLE = ? ORDER BY ACTION_ORDER",
+		d.Database, table)
+	if err != nil {
+		return err
+	}
+	for _, trigger := range triggers {
+		mode, create, err := showCreate(ctx, conn, fmt.Sprintf("SHOW CREATE TRIGGER %s.%s", quoteIdent(d.Database), quoteIdent(trigger)))
+		if err != nil {
+			return fmt.Errorf("trigger %s: %v", trigger, err)
+		}
+		fmt.Fprintf(w, "--\n-- Trigger %s\n--\n\n", trigger)
+		fmt.Fprintf(w, "DROP TRIGGER IF EXISTS %s;\n", quoteIdent(trigger))
+		writeRoutine(w, mode, create)
+	}
+	return nil
+}
+
+// dumpRoutines write stored procedures and functions of database
+func (d *Dumper) dumpRoutines(ctx context.Context, conn *sql.Conn, w *bufio.Writer) error {
+	for _, kind := range []string{"PROCEDURE", "FUNCTION"} {
+		routines, err := queryNames(ctx, conn,
+			"SELECT ROUTINE_NAME FROM information_schema.ROUTINES WHERE ROUTINE_SCHEMA = ? AND ROUTINE_TYPE = ? ORDER BY ROUTINE_NAME",
+			d.Database, kind)
+		if err != nil {
+			return err
+		}
+		for _, routine := range routines {
+			mode, create, err := showCreate(ctx, conn, fmt.Sprintf("SHOW CREATE %s %s.%s", kind, quoteIdent(d.Database), quoteIdent(routine)))
+			if err != nil {
+				return fmt.Errorf("%s %s: %v", strings.ToLower(kind), routine, err)
+			}
+			fmt.Fprintf(w, "--\n-- %s %s\n--\n\n", strings.ToLower(kind), routine)
+			fmt.Fprintf(w, "DROP %s IF EXISTS %s;\n", kind, quoteIdent(routine))
+			writeRoutine(w, mode, create)
+		}
+	}
+	return nil
+}
+
+// writeRoutine write body of trigger or routine with its SQL mode, body
+// contains ";" so it is delimited by ";;"
+func writeRoutine(w *bufio.Writer, mode, create string) {
+	// Definer user doesn't exist on review servers
+	create = definerRegexp.ReplaceAllString(create, "")
+	fmt.Fprintf(w, "SET SQL_MODE=%s;\n", quoteString(mode))
+	fmt.Fprintf(w, "DELIMITER ;;\n%s;;\nDELIMITER ;\n", create)
+	fmt.Fprintf(w, "SET SQL_MODE='%s';\n\n", dumpMode)
+}
+
+// queryNames returns values of the first column of query
+func queryNames(ctx context.Context, conn *sql.Conn, query string, args ...interface{}) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// showCreate returns SQL mode and statement of SHOW CREATE TRIGGER, PROCEDURE
+// or FUNCTION, they are the second and the third columns
+func showCreate(ctx context.Context, conn *sql.Conn, query string) (string, string, error) {
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return "", "", err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", "", err
+	}
+	if len(columns) < 3 {
+		return "", "", fmt.Errorf("unexpected columns %v", columns)
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return "", "", err
+		}
+		return "", "", fmt.Errorf("%s: no rows", query)
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return "", "", err
+	}
+	// Statement is NULL without privileges to read it
+	if !values[2].Valid {
+		return "", "", fmt.Errorf("%s: no privileges to read definition", query)
+	}
+	return values[1].String, values[2].String, nil
+}
+
+// sqlValue format raw column value as SQL literal
+func sqlValue(v sql.RawBytes, typeName string) string {
+	if v == nil {
+		return "NULL"
+	}
+	switch strings.TrimPrefix(typeName, "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "DECIMAL", "FLOAT", "DOUBLE", "YEAR":
+		return string(v)
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "BIT", "GEOMETRY":
+		if len(v) == 0 {
+			return "''"
+		}
+		return "0x" + hex.EncodeToString(v)
+	}
+	return quoteString(string(v))
+}
+
+// quoteString quote string literal with MySQL escapes
+func quoteString(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case 0:
+			b.WriteString(`\0`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\'':
+			b.WriteString(`\'`)
+		case '"':
+			b.WriteString(`\"`)
+		case 0x1a:
+			b.WriteString(`\Z`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// quoteIdent quote MySQL identifier with backticks
+func quoteIdent(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
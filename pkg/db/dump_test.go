@@ -0,0 +1,96 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQuoteString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", `''`},
+		{"plain", `'plain'`},
+		{"it's", `'it\'s'`},
+		{`say "hi"`, `'say \"hi\"'`},
+		{`C:\dir`, `'C:\\dir'`},
+		{"line\nbreak\r", `'line\nbreak\r'`},
+		{"nul\x00ctrl-z\x1a", `'nul\0ctrl-z\Z'`},
+		{"юникод", `'юникод'`},
+	}
+	for _, tt := range tests {
+		if got := quoteString(tt.in); got != tt.want {
+			t.Errorf("quoteString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteIdent(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"users", "`users`"},
+		{"feature_a", "`feature_a`"},
+		{"my table", "`my table`"},
+		{"a`b", "`a``b`"},
+		{"`; DROP DATABASE x; --", "```; DROP DATABASE x; --`"},
+	}
+	for _, tt := range tests {
+		if got := quoteIdent(tt.in); got != tt.want {
+			t.Errorf("quoteIdent(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGeneratedColumn(t *testing.T) {
+	tests := []struct {
+		extra string
+		want  bool
+	}{
+		{"", false},
+		{"auto_increment", false},
+		{"DEFAULT_GENERATED", false},
+		{"DEFAULT_GENERATED on update CURRENT_TIMESTAMP", false},
+		{"VIRTUAL GENERATED", true},
+		{"STORED GENERATED", true},
+		{"PERSISTENT GENERATED", true},
+		{"virtual generated", true},
+	}
+	for _, tt := range tests {
+		if got := generatedColumn(tt.extra); got != tt.want {
+			t.Errorf("generatedColumn(%q) = %v, want %v", tt.extra, got, tt.want)
+		}
+	}
+}
+
+// TestWriteRoutine checks that routine written to dump is read back by
+// StatementScanner as one statement without definer
+func TestWriteRoutine(t *testing.T) {
+	create := "CREATE DEFINER=`root`@`localhost` PROCEDURE `touch`()\nBEGIN\n  UPDATE a SET b = 'x;y';\n  DELETE FROM c;\nEND"
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	writeRoutine(w, "STRICT_TRANS_TABLES", create)
+	w.Flush()
+
+	s := NewStatementScanner(&buf)
+	var statements []string
+	for s.Scan() {
+		statements = append(statements, strings.TrimSpace(s.Statement()))
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"SET SQL_MODE='STRICT_TRANS_TABLES'",
+		"CREATE PROCEDURE `touch`()\nBEGIN\n  UPDATE a SET b = 'x;y';\n  DELETE FROM c;\nEND",
+		"SET SQL_MODE='" + dumpMode + "'",
+	}
+	if !reflect.DeepEqual(statements, want) {
+		t.Errorf("statements = %q, want %q", statements, want)
+	}
+}
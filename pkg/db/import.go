@@ -0,0 +1,245 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/plan"
+)
+
+// ImportProgress represent amount of dump read and statements executed
+type ImportProgress struct {
+	Bytes      int64
+	Statements int64
+}
+
+// Importer execute SQL statements of dump stream on a single connection
+type Importer struct {
+	DB *sql.DB
+	// Database is selected before import, if set
+	Database string
+	// Progress is called every ProgressInterval and when import is finished
+	Progress         func(p ImportProgress)
+	ProgressInterval time.Duration
+
+	progress ImportProgress
+	last     time.Time
+}
+
+// Import read SQL statements from r and execute them one by one
+func (i *Importer) Import(ctx context.Context, r io.Reader) (ImportProgress, error) {
+	if plan.Record(plan.SQL, "import SQL dump stream") {
+		return i.progress, nil
+	}
+	conn, err := i.DB.Conn(ctx)
+	if err != nil {
+		return i.progress, err
+	}
+	defer conn.Close()
+
+	if i.Database != "" {
+		if _, err = conn.ExecContext(ctx, "USE "+quoteIdent(i.Database)); err != nil {
+			return i.progress, err
+		}
+	}
+
+	counter := &countReader{r: r}
+	scanner := NewStatementScanner(counter)
+	for scanner.Scan() {
+		if _, err = conn.ExecContext(ctx, scanner.Statement()); err != nil {
+			return i.progress, fmt.Errorf("statement %d: %v", i.progress.Statements+1, err)
+		}
+		i.progress.Bytes = counter.n
+		i.progress.Statements++
+		i.report(false)
+	}
+	if err = scanner.Err(); err != nil {
+		return i.progress, err
+	}
+	i.progress.Bytes = counter.n
+	i.report(true)
+	return i.progress, nil
+}
+
+func (i *Importer) report(final bool) {
+	if i.Progress == nil {
+		return
+	}
+	interval := i.ProgressInterval
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+	if final || time.Since(i.last) >= interval {
+		i.last = time.Now()
+		i.Progress(i.progress)
+	}
+}
+
+// countReader counts bytes read through it
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// StatementScanner split SQL dump into statements like mysql client does: by
+// delimiter outside of quotes and comments, DELIMITER command is supported.
+// Statements which contain only comments are skipped.
+type StatementScanner struct {
+	r         *bufio.Reader
+	delimiter string
+	stmt      bytes.Buffer
+	err       error
+}
+
+// NewStatementScanner returns scanner of SQL statements
+func NewStatementScanner(r io.Reader) *StatementScanner {
+	return &StatementScanner{r: bufio.NewReaderSize(r, 256*1024), delimiter: ";"}
+}
+
+// Statement returns statement found by the last Scan, without delimiter
+func (s *StatementScanner) Statement() string {
+	return s.stmt.String()
+}
+
+// Err returns the first error which is not io.EOF
+func (s *StatementScanner) Err() error {
+	return s.err
+}
+
+// Scan advance to the next statement, returns false at the end of input or on error
+func (s *StatementScanner) Scan() bool {
+	s.stmt.Reset()
+	var (
+		quote        byte // ' " ` or 0
+		lineComment  bool
+		blockComment bool
+		code         bool // statement contains something except comments and spaces
+		lineStart    = true
+	)
+
+	for {
+		c, err := s.r.ReadByte()
+		if err == io.EOF {
+			if code {
+				return true
+			}
+			return false
+		}
+		if err != nil {
+			s.err = err
+			return false
+		}
+
+		switch {
+		case lineComment:
+			s.stmt.WriteByte(c)
+			if c == '\n' {
+				lineComment = false
+				lineStart = true
+			}
+			continue
+		case blockComment:
+			s.stmt.WriteByte(c)
+			if c == '*' && s.peek("/") {
+				s.r.ReadByte()
+				s.stmt.WriteByte('/')
+				blockComment = false
+			}
+			continue
+		case quote != 0:
+			s.stmt.WriteByte(c)
+			if c == '\\' && quote != '`' {
+				if n, err := s.r.ReadByte(); err == nil {
+					s.stmt.WriteByte(n)
+				}
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		// DELIMITER is a client command, it's never sent to server
+		if lineStart && !code && (c == 'D' || c == 'd') && s.peekFold("ELIMITER ") {
+			line, err := s.r.ReadString('\n')
+			if err != nil && err != io.EOF {
+				s.err = err
+				return false
+			}
+			fields := strings.Fields(string(c) + line)
+			if len(fields) > 1 {
+				s.delimiter = fields[1]
+			}
+			s.stmt.Reset()
+			lineStart = true
+			continue
+		}
+
+		if c == s.delimiter[0] && s.peek(s.delimiter[1:]) {
+			s.r.Discard(len(s.delimiter) - 1)
+			if code {
+				return true
+			}
+			s.stmt.Reset()
+			continue
+		}
+
+		s.stmt.WriteByte(c)
+		lineStart = c == '\n'
+		switch {
+		case c == '#':
+			lineComment = true
+		case c == '-' && s.peekDashComment():
+			lineComment = true
+		case c == '/' && s.peek("*"):
+			// Conditional comments /*!40101 ... */ are executed by server
+			if !s.peek("*!") {
+				blockComment = true
+			} else {
+				code = true
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			code = true
+		case c != ' ' && c != '\t' && c != '\n' && c != '\r':
+			code = true
+		}
+	}
+}
+
+// peek returns true if the next bytes of input are s
+func (s *StatementScanner) peek(str string) bool {
+	if str == "" {
+		return true
+	}
+	b, err := s.r.Peek(len(str))
+	return err == nil && string(b) == str
+}
+
+// peekDashComment returns true if "-" read before starts "-- " comment: the
+// next byte is "-" followed by whitespace or control character, like space,
+// tab or "\r" of CRLF, or by the end of input
+func (s *StatementScanner) peekDashComment() bool {
+	b, _ := s.r.Peek(2)
+	if len(b) == 1 {
+		return b[0] == '-'
+	}
+	return len(b) == 2 && b[0] == '-' && (b[1] <= ' ' || b[1] == 0x7f)
+}
+
+// peekFold returns true if the next bytes of input are s, ignoring case
+func (s *StatementScanner) peekFold(str string) bool {
+	b, err := s.r.Peek(len(str))
+	return err == nil && strings.EqualFold(string(b), str)
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func scanStatements(t *testing.T, input string) []string {
+	t.Helper()
+	s := NewStatementScanner(strings.NewReader(input))
+	var statements []string
+	for s.Scan() {
+		statements = append(statements, strings.TrimSpace(s.Statement()))
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("scan %q: %v", input, err)
+	}
+	return statements
+}
+
+func TestStatementScanner(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "empty",
+			input: "",
+			want:  nil,
+		},
+		{
+			name:  "statements",
+			input: "CREATE TABLE a (id int);\nINSERT INTO a VALUES (1);\n",
+			want:  []string{"CREATE TABLE a (id int)", "INSERT INTO a VALUES (1)"},
+		},
+		{
+			name:  "last statement without delimiter",
+			input: "SELECT 1;\nSELECT 2",
+			want:  []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:  "delimiter in quotes",
+			input: `INSERT INTO a VALUES ('a;b', "c;d", 'it\'s;');` + "\nSELECT `x;y` FROM a;",
+			want:  []string{`INSERT INTO a VALUES ('a;b', "c;d", 'it\'s;')`, "SELECT `x;y` FROM a"},
+		},
+		{
+			name:  "comments only are skipped",
+			input: "-- MySQL dump;\n# comment;\n/* block; */\n;\nSELECT 1;",
+			want:  []string{"SELECT 1"},
+		},
+		{
+			name:  "conditional comment is executed",
+			input: "/*!40101 SET NAMES utf8mb4 */;\n",
+			want:  []string{"/*!40101 SET NAMES utf8mb4 */"},
+		},
+		{
+			name:  "delimiter command",
+			input: "DELIMITER ;;\nCREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN SET NEW.id = 1; END;;\nDELIMITER ;\nSELECT 1;",
+			want:  []string{"CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN SET NEW.id = 1; END", "SELECT 1"},
+		},
+		{
+			name:  "lower case delimiter command",
+			input: "delimiter $$\nSELECT 1$$\ndelimiter ;\nSELECT 2;",
+			want:  []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:  "delimiter word inside statement",
+			input: "SELECT 'x'\nDELIMITER;",
+			want:  []string{"SELECT 'x'\nDELIMITER"},
+		},
+		{
+			name:  "comment after tab",
+			input: "--\tMySQL dump;\nSELECT 1;",
+			want:  []string{"--\tMySQL dump;\nSELECT 1"},
+		},
+		{
+			name:  "CRLF line endings",
+			input: "-- MySQL dump;\r\nSELECT 1;\r\n--\r\n;\r\nSELECT 2;\r\n--",
+			want:  []string{"-- MySQL dump;\r\nSELECT 1", "SELECT 2"},
+		},
+		{
+			name:  "double minus without whitespace is not comment",
+			input: "SELECT 1--1;\n",
+			want:  []string{"SELECT 1--1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scanStatements(t, tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("statements of %q = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
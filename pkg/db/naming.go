@@ -0,0 +1,79 @@
+package db
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// Limits of MySQL identifiers
+const (
+	MaxDatabaseName = 64
+	MaxUserName     = 32
+)
+
+// hashLength is length of hash suffix of shortened or lossy names
+const hashLength = 8
+
+// ErrNameCollision is returned when database or user name of virtual host is
+// already used by another one
+var ErrNameCollision = errors.New("database name collision")
+
+// Names are database and user names of virtual host
+type Names struct {
+	Database string
+	User     string
+}
+
+// DeriveNames returns database and user names of refslug. Every "-" becomes
+// "_", upper case letters and other characters except a-z and 0-9 are replaced
+// too, but then the name is lossy and gets "_<hash>" suffix of refslug, so
+// "feature-a" and "feature_a" differ.
+// Names longer than MaxDatabaseName and MaxUserName are truncated with the
+// same suffix, so branches with a common long prefix differ too.
+func DeriveNames(refSlug string) Names {
+	var b strings.Builder
+	lossy := false
+	for _, r := range refSlug {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '-':
+			b.WriteByte('_')
+		case r >= 'A' && r <= 'Z':
+			b.WriteRune(r - 'A' + 'a')
+			lossy = true
+		default:
+			b.WriteByte('_')
+			lossy = true
+		}
+	}
+	base := b.String()
+	return Names{
+		Database: shortenName(base, refSlug, MaxDatabaseName, lossy),
+		User:     shortenName(base, refSlug, MaxUserName, lossy),
+	}
+}
+
+// shortenName returns name of at most max bytes, with hash of refslug if name
+// is truncated or lossy
+func shortenName(name string, refSlug string, max int, lossy bool) string {
+	if !lossy && len(name) <= max {
+		return name
+	}
+	sum := sha1.Sum([]byte(refSlug))
+	suffix := "_" + hex.EncodeToString(sum[:])[:hashLength]
+	if len(name) > max-len(suffix) {
+		name = name[:max-len(suffix)]
+	}
+	return name + suffix
+}
+
+// DatabaseExists returns true if database exists
+func DatabaseExists(db *sql.DB, dbname string) (bool, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?", dbname).Scan(&n)
+	return n > 0, err
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestDeriveNames(t *testing.T) {
+	long := strings.Repeat("feature-", 10) + "login"
+	tests := []struct {
+		name    string
+		refSlug string
+		want    Names
+	}{
+		{
+			name:    "plain",
+			refSlug: "master",
+			want:    Names{Database: "master", User: "master"},
+		},
+		{
+			name:    "dashes",
+			refSlug: "feature-login-2",
+			want:    Names{Database: "feature_login_2", User: "feature_login_2"},
+		},
+		{
+			name:    "underscore is lossy",
+			refSlug: "feature_a",
+			want:    Names{Database: "feature_a_" + hashOf("feature_a"), User: "feature_a_" + hashOf("feature_a")},
+		},
+		{
+			name:    "upper case is lossy",
+			refSlug: "Feature-A",
+			want:    Names{Database: "feature_a_" + hashOf("Feature-A"), User: "feature_a_" + hashOf("Feature-A")},
+		},
+		{
+			name:    "long user name",
+			refSlug: "feature-login-with-a-long-name-12",
+			want:    Names{Database: "feature_login_with_a_long_name_12", User: "feature_login_with_a_lo_" + hashOf("feature-login-with-a-long-name-12")},
+		},
+		{
+			name:    "long names",
+			refSlug: long,
+			want: Names{
+				Database: strings.Replace(long, "-", "_", -1)[:MaxDatabaseName-hashLength-1] + "_" + hashOf(long),
+				User:     strings.Replace(long, "-", "_", -1)[:MaxUserName-hashLength-1] + "_" + hashOf(long),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DeriveNames(tt.refSlug)
+			if got != tt.want {
+				t.Errorf("DeriveNames(%q) = %+v, want %+v", tt.refSlug, got, tt.want)
+			}
+			if len(got.Database) > MaxDatabaseName || len(got.User) > MaxUserName {
+				t.Errorf("DeriveNames(%q) = %+v, names are too long", tt.refSlug, got)
+			}
+		})
+	}
+}
+
+func TestDeriveNamesDiffer(t *testing.T) {
+	long := strings.Repeat("a", 40)
+	pairs := [][2]string{
+		{"feature-a", "feature_a"},
+		{"feature-a", "Feature-A"},
+		{long + "-one", long + "-two"},
+	}
+	for _, pair := range pairs {
+		a, b := DeriveNames(pair[0]), DeriveNames(pair[1])
+		if a.Database == b.Database || a.User == b.User {
+			t.Errorf("names of %q and %q are the same: %+v", pair[0], pair[1], a)
+		}
+	}
+}
+
+// hashOf returns hash suffix of refslug without "_"
+func hashOf(refSlug string) string {
+	sum := sha1.Sum([]byte(refSlug))
+	return hex.EncodeToString(sum[:])[:hashLength]
+}
@@ -1,12 +1,12 @@
 package db
 
 import (
-	"fmt"
 	"log"
 	"regexp"
 )
 
-// ParseBranchName parse branch name symbols and lenght
+// ParseBranchName parse branch name symbols and lenght. Names of virtual hosts
+// created before DeriveNames, it is used for virtual hosts without manifest.
 func ParseBranchName(name string) string {
 
 	// Remove all Non-Alphanumeric Characters from a NameBranch
@@ -20,9 +20,9 @@ func ParseBranchName(name string) string {
 	// User name (should be no longer than 32) for Percona Server
 	if len(branchString) > 32 {
 		branchCut := branchString[0:32]
-		fmt.Printf("A string of %s becomes %s \n", name, branchCut)
+		log.Printf("A string of %s becomes %s \n", name, branchCut)
 		return branchCut
 	}
-	fmt.Printf("A string of %s becomes %s \n", name, branchString)
+	log.Printf("A string of %s becomes %s \n", name, branchString)
 	return branchString
 }
@@ -3,11 +3,18 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/plan"
 )
 
-// DropSalary clear data before using database
-func DropSalary(db *sql.DB, dbname string) (int64, error) {
-	res, err := db.Exec(fmt.Sprintf("UPDATE %s.user_data SET salary = 10000, salary_proposed = 11000;", dbname))
+// execQuery execute query and returns rows affected, in dry-run mode query is
+// only added to plan
+func execQuery(db *sql.DB, query string) (int64, error) {
+	if plan.Record(plan.SQL, "%s", query) {
+		return 0, nil
+	}
+	res, err := db.Exec(query)
 	if err != nil {
 		return 0, err
 	}
@@ -16,45 +23,72 @@ func DropSalary(db *sql.DB, dbname string) (int64, error) {
 
 // DropDB drop MySQL database
 func DropDB(db *sql.DB, dbname string) (int64, error) {
-	res, err := db.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s;", dbname))
-	if err != nil {
-		return 0, err
-	}
-	return res.RowsAffected()
+	return execQuery(db, "DROP DATABASE IF EXISTS "+quoteIdent(dbname)+";")
 }
 
-// DropUser drop user
-func DropUser(db *sql.DB, dbname string) (int64, error) {
-	res, err := db.Exec(fmt.Sprintf("DROP USER '%s'@'localhost';", dbname))
-	if err != nil {
-		return 0, err
-	}
-	return res.RowsAffected()
+// DropUser drop user if exists, user is recorded before it is created by import
+func DropUser(db *sql.DB, user string) (int64, error) {
+	return execQuery(db, "DROP USER IF EXISTS "+localUser(user)+";")
 }
 
 // CreateDB create MySQL database
 func CreateDB(db *sql.DB, dbname string) (int64, error) {
-	res, err := db.Exec(fmt.Sprintf("CREATE DATABASE %s CHARACTER SET utf8 collate utf8_unicode_ci;", dbname))
-	if err != nil {
-		return 0, err
-	}
-	return res.RowsAffected()
+	return execQuery(db, "CREATE DATABASE "+quoteIdent(dbname)+" CHARACTER SET utf8 collate utf8_unicode_ci;")
 }
 
-// GrantUserPriv grant user privileges to MySQL DB
-func GrantUserPriv(db *sql.DB, dbname string) (int64, error) {
-	res, err := db.Exec(fmt.Sprintf("GRANT ALL PRIVILEGES ON %s.* TO '%s'@'localhost' IDENTIFIED BY '%s';", dbname, dbname, dbname))
+// GrantUserPriv grant user privileges to MySQL DB, user is created or its password is changed
+func GrantUserPriv(db *sql.DB, dbname string, user string, password string) (int64, error) {
+	query := fmt.Sprintf("GRANT ALL PRIVILEGES ON %s.* TO %s IDENTIFIED BY %s;", quoteIdent(dbname), localUser(user), quoteString(password))
+	// Password is masked in plan
+	if plan.Record(plan.SQL, "%s", strings.Replace(query, quoteString(password), "'***'", 1)) {
+		return 0, nil
+	}
+	res, err := db.Exec(query)
 	if err != nil {
 		return 0, err
 	}
 	return res.RowsAffected()
 }
 
+// localUser returns quoted account of user connecting from localhost
+func localUser(user string) string {
+	return quoteString(user) + "@'localhost'"
+}
+
+// UserExists returns true if user connecting from localhost exists
+func UserExists(db *sql.DB, user string) (bool, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM mysql.user WHERE User = ? AND Host = 'localhost'", user).Scan(&n)
+	return n > 0, err
+}
+
 // FlushPriv flush the privileges
 func FlushPriv(db *sql.DB) (int64, error) {
-	res, err := db.Exec("FLUSH PRIVILEGES;")
+	return execQuery(db, "FLUSH PRIVILEGES;")
+}
+
+// ListDatabases returns user databases, without MySQL system schemas
+func ListDatabases(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SELECT SCHEMA_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME NOT IN ('mysql', 'information_schema', 'performance_schema', 'sys') ORDER BY SCHEMA_NAME")
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return res.RowsAffected()
+	defer rows.Close()
+
+	var databases []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		databases = append(databases, name)
+	}
+	return databases, rows.Err()
+}
+
+// DatabaseSize returns size of data and indexes of database in bytes
+func DatabaseSize(db *sql.DB, dbname string) (int64, error) {
+	var size int64
+	err := db.QueryRow("SELECT COALESCE(SUM(DATA_LENGTH + INDEX_LENGTH), 0) FROM information_schema.TABLES WHERE TABLE_SCHEMA = ?", dbname).Scan(&size)
+	return size, err
 }
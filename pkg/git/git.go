@@ -0,0 +1,224 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/plan"
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+// Remote is name of remote repository of virtual hosts
+const Remote = "origin"
+
+var (
+	// ErrUnknownCommit is returned by Checkout when commit is not fetched
+	ErrUnknownCommit = errors.New("unknown commit")
+	// ErrNonFastForward is returned by Checkout when checked out commit is not
+	// an ancestor of new one, like after force push
+	ErrNonFastForward = errors.New("non-fast-forward update")
+	// ErrDirtyWorktree is returned by Checkout when tracked files are changed
+	ErrDirtyWorktree = errors.New("worktree has local changes")
+)
+
+// Auth returns ssh authentication by private key file, nil if keyFile is
+// empty, then ssh agent is used for ssh URLs
+func Auth(keyFile string) (transport.AuthMethod, error) {
+	if keyFile == "" {
+		return nil, nil
+	}
+	return ssh.NewPublicKeysFromFile("git", keyFile, "")
+}
+
+// Repository is git repository of virtual host directory
+type Repository struct {
+	Dir  string
+	Auth transport.AuthMethod
+	repo *gogit.Repository
+}
+
+// Init create repository in dir with origin remote which tracks only branch,
+// like git remote add -t <branch> -f origin <url>, and fetch it
+func Init(ctx context.Context, dir string, url string, branch string, auth transport.AuthMethod) (*Repository, error) {
+	if plan.Record(plan.Command, "git init %s, remote %s %s, fetch %s", dir, Remote, url, branch) {
+		return &Repository{Dir: dir, Auth: auth}, nil
+	}
+	repo, err := gogit.PlainInit(dir, false)
+	if err != nil {
+		return nil, fmt.Errorf("git init %s: %v", dir, err)
+	}
+	_, err = repo.CreateRemote(&config.RemoteConfig{
+		Name: Remote,
+		URLs: []string{url},
+		Fetch: []config.RefSpec{
+			config.RefSpec(fmt.Sprintf("+refs/heads/%s:refs/remotes/%s/%s", branch, Remote, branch)),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("git remote add %s: %v", url, err)
+	}
+	r := &Repository{Dir: dir, Auth: auth, repo: repo}
+	return r, r.Fetch(ctx)
+}
+
+// Open returns repository of dir
+func Open(dir string, auth transport.AuthMethod) (*Repository, error) {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return nil, fmt.Errorf("git open %s: %v", dir, err)
+	}
+	return &Repository{Dir: dir, Auth: auth, repo: repo}, nil
+}
+
+// Fetch fetch branches of origin and prune deleted ones
+func (r *Repository) Fetch(ctx context.Context) error {
+	if plan.Record(plan.Command, "git fetch --prune %s in %s", Remote, r.Dir) {
+		return nil
+	}
+	err := r.repo.FetchContext(ctx, &gogit.FetchOptions{
+		RemoteName: Remote,
+		Auth:       r.Auth,
+		Prune:      true,
+		Force:      true,
+	})
+	if err != nil && err != gogit.NoErrAlreadyUpToDate {
+		return fmt.Errorf("git fetch %s: %v", r.Dir, err)
+	}
+	return nil
+}
+
+// Head returns hash of checked out commit
+func (r *Repository) Head() (string, error) {
+	ref, err := r.repo.Head()
+	if err != nil {
+		return "", err
+	}
+	return ref.Hash().String(), nil
+}
+
+// Checkout check out commit with detached HEAD. Returns ErrUnknownCommit if
+// commit is not fetched, ErrDirtyWorktree if tracked files are changed and
+// ErrNonFastForward if current commit is not an ancestor of new one. With
+// force worktree is hard reset to commit instead, like for force pushed
+// branch. Untracked files, like installed dependencies, are kept.
+func (r *Repository) Checkout(ctx context.Context, commit string, force bool) error {
+	if plan.Record(plan.Command, "git checkout %s in %s, force %t", commit, r.Dir, force) {
+		return nil
+	}
+	hash, err := r.repo.ResolveRevision(plumbing.Revision(commit))
+	if err != nil {
+		return fmt.Errorf("%w %s: %v", ErrUnknownCommit, commit, err)
+	}
+	target, err := r.repo.CommitObject(*hash)
+	if err != nil {
+		return fmt.Errorf("%w %s: %v", ErrUnknownCommit, commit, err)
+	}
+	wt, err := r.repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	changed, err := changedFiles(wt)
+	if err != nil {
+		return err
+	}
+	if !force {
+		if err = r.checkFastForward(target); err != nil {
+			return err
+		}
+		if len(changed) > 0 {
+			return fmt.Errorf("%w: %s", ErrDirtyWorktree, strings.Join(changed, ", "))
+		}
+	} else if len(changed) > 0 {
+		// Only changed tracked files are reset, hard reset of the whole
+		// worktree would delete untracked files too
+		head, err := r.repo.Head()
+		if err != nil {
+			return err
+		}
+		if err = wt.Reset(&gogit.ResetOptions{Commit: head.Hash(), Mode: gogit.HardReset, Files: changed}); err != nil {
+			return fmt.Errorf("git reset %s: %v", r.Dir, err)
+		}
+	}
+
+	// Checkout without force updates only files changed between commits
+	if err = wt.Checkout(&gogit.CheckoutOptions{Hash: *hash}); err != nil {
+		return fmt.Errorf("git checkout %s: %v", commit, err)
+	}
+	return nil
+}
+
+// checkFastForward returns ErrNonFastForward if checked out commit is not an
+// ancestor of target, new repository without commits is fast-forward
+func (r *Repository) checkFastForward(target *object.Commit) error {
+	ref, err := r.repo.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if ref.Hash() == target.Hash {
+		return nil
+	}
+	head, err := r.repo.CommitObject(ref.Hash())
+	if err != nil {
+		return err
+	}
+	ok, err := head.IsAncestor(target)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s is not an ancestor of %s", ErrNonFastForward, head.Hash, target.Hash)
+	}
+	return nil
+}
+
+// changedFiles returns sorted tracked files which are changed or staged
+func changedFiles(wt *gogit.Worktree) ([]string, error) {
+	status, err := wt.Status()
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	for path, s := range status {
+		if s.Worktree == gogit.Untracked && s.Staging == gogit.Untracked {
+			continue
+		}
+		if s.Worktree != gogit.Unmodified || s.Staging != gogit.Unmodified {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// RemoteBranches returns branches of origin, like git ls-remote --heads origin.
+// It is run in dry-run mode too.
+func (r *Repository) RemoteBranches(ctx context.Context) ([]string, error) {
+	remote, err := r.repo.Remote(Remote)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := remote.ListContext(ctx, &gogit.ListOptions{Auth: r.Auth})
+	if err != nil {
+		return nil, fmt.Errorf("git ls-remote %s: %v", Remote, err)
+	}
+	var branches []string
+	for _, ref := range refs {
+		if ref.Name().IsBranch() {
+			branches = append(branches, ref.Name().Short())
+		}
+	}
+	sort.Strings(branches)
+	return branches, nil
+}
@@ -0,0 +1,166 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// run runs git command in dir and returns its trimmed output
+func run(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	c := exec.Command("git", args...)
+	c.Dir = dir
+	c.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir,
+	)
+	out, err := c.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commit writes file in clone, commits and pushes it, returns commit hash
+func commit(t *testing.T, clone, file, content string, pushArgs ...string) string {
+	t.Helper()
+	if err := ioutil.WriteFile(filepath.Join(clone, file), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run(t, clone, "add", file)
+	run(t, clone, "commit", "-q", "-m", content)
+	run(t, clone, append([]string{"push", "-q", "origin"}, pushArgs...)...)
+	return run(t, clone, "rev-parse", "HEAD")
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	ctx := context.Background()
+	tmp := t.TempDir()
+
+	// Remote repository with master and feature branches
+	origin := filepath.Join(tmp, "origin.git")
+	run(t, tmp, "init", "-q", "--bare", origin)
+	clone := filepath.Join(tmp, "clone")
+	run(t, tmp, "init", "-q", clone)
+	run(t, clone, "remote", "add", "origin", origin)
+	run(t, clone, "checkout", "-q", "-b", "master")
+	first := commit(t, clone, "index.php", "first", "master")
+	run(t, clone, "checkout", "-q", "-b", "feature")
+	commit(t, clone, "feature.php", "feature", "feature")
+	run(t, clone, "checkout", "-q", "master")
+
+	// Virtual host directory tracks master
+	hostDir := filepath.Join(tmp, "master")
+	repo, err := Init(ctx, hostDir, origin, "master", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.Checkout(ctx, first, false); err != nil {
+		t.Fatalf("checkout of first commit: %v", err)
+	}
+	if head, _ := repo.Head(); head != first {
+		t.Errorf("Head = %s, want %s", head, first)
+	}
+	if got := readFile(t, filepath.Join(hostDir, "index.php")); got != "first" {
+		t.Errorf("index.php = %q, want first", got)
+	}
+	// Only master is fetched
+	if _, err = os.Stat(filepath.Join(hostDir, "feature.php")); !os.IsNotExist(err) {
+		t.Errorf("feature.php of feature branch is checked out: %v", err)
+	}
+
+	// Installed dependencies are untracked files, they are kept by every checkout
+	untracked := filepath.Join(hostDir, "vendor", "autoload.php")
+	if err = os.MkdirAll(filepath.Dir(untracked), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(untracked, []byte("vendor"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fast-forward
+	second := commit(t, clone, "index.php", "second", "master")
+	if err = repo.Checkout(ctx, second, false); !errors.Is(err, ErrUnknownCommit) {
+		t.Errorf("checkout before fetch = %v, want ErrUnknownCommit", err)
+	}
+	if err = repo.Fetch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.Checkout(ctx, second, false); err != nil {
+		t.Fatalf("fast-forward checkout: %v", err)
+	}
+	if got := readFile(t, filepath.Join(hostDir, "index.php")); got != "second" {
+		t.Errorf("index.php = %q, want second", got)
+	}
+
+	// Changed tracked file is not overwritten without force
+	if err = ioutil.WriteFile(filepath.Join(hostDir, "index.php"), []byte("local"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.Checkout(ctx, second, false); !errors.Is(err, ErrDirtyWorktree) {
+		t.Errorf("checkout of dirty worktree = %v, want ErrDirtyWorktree", err)
+	}
+
+	// Force push replaces second commit
+	run(t, clone, "reset", "-q", "--hard", first)
+	rewritten := commit(t, clone, "index.php", "rewritten", "--force", "master")
+	if err = repo.Fetch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.Checkout(ctx, rewritten, false); !errors.Is(err, ErrNonFastForward) {
+		t.Errorf("checkout of force pushed commit = %v, want ErrNonFastForward", err)
+	}
+	if err = repo.Checkout(ctx, rewritten, true); err != nil {
+		t.Fatalf("forced checkout: %v", err)
+	}
+	if head, _ := repo.Head(); head != rewritten {
+		t.Errorf("Head = %s, want %s", head, rewritten)
+	}
+	if got := readFile(t, filepath.Join(hostDir, "index.php")); got != "rewritten" {
+		t.Errorf("index.php = %q, want rewritten", got)
+	}
+	if got := readFile(t, untracked); got != "vendor" {
+		t.Errorf("untracked file = %q, want vendor", got)
+	}
+
+	if err = repo.Checkout(ctx, strings.Repeat("0", 40), true); !errors.Is(err, ErrUnknownCommit) {
+		t.Errorf("checkout of unknown commit = %v, want ErrUnknownCommit", err)
+	}
+
+	// Remote branches are listed from origin, not fetched ones
+	opened, err := Open(hostDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	branches, err := opened.RemoteBranches(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"feature", "master"}; !reflect.DeepEqual(branches, want) {
+		t.Errorf("RemoteBranches = %q, want %q", branches, want)
+	}
+	run(t, clone, "push", "-q", "origin", "--delete", "feature")
+	if branches, err = opened.RemoteBranches(ctx); err != nil || !reflect.DeepEqual(branches, []string{"master"}) {
+		t.Errorf("RemoteBranches after delete = %q, %v, want [master]", branches, err)
+	}
+}
@@ -0,0 +1,106 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// Kinds of side effects
+const (
+	Command = "command"
+	SQL     = "sql"
+	Write   = "write"
+	Chown   = "chown"
+	Mkdir   = "mkdir"
+	Remove  = "remove"
+	Rename  = "rename"
+)
+
+// Action is a side effect which would be executed without dry-run
+type Action struct {
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+var (
+	mu      sync.Mutex
+	dryRun  bool
+	actions []Action
+)
+
+// SetDryRun enable or disable dry-run mode
+func SetDryRun(enabled bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	dryRun = enabled
+}
+
+// DryRun returns true in dry-run mode
+func DryRun() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return dryRun
+}
+
+// Record add action to plan in dry-run mode. It returns true in dry-run mode,
+// then caller must not execute the action.
+func Record(kind string, format string, args ...interface{}) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	if !dryRun {
+		return false
+	}
+	actions = append(actions, Action{Kind: kind, Detail: fmt.Sprintf(format, args...)})
+	return true
+}
+
+// Actions returns recorded actions in order
+func Actions() []Action {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]Action(nil), actions...)
+}
+
+// Print write plan as numbered list or as JSON array
+func Print(w io.Writer, asJSON bool) error {
+	list := Actions()
+	if asJSON {
+		if list == nil {
+			list = []Action{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", " ")
+		return enc.Encode(list)
+	}
+
+	fmt.Fprintf(w, "\nPlan, %d actions:\n\n", len(list))
+	for i, a := range list {
+		if _, err := fmt.Fprintf(w, "%3d. %-7s %s\n", i+1, a.Kind, a.Detail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start set dry-run mode, returned func prints plan to standard output. In
+// JSON mode other output of command is moved to standard error, so plan
+// could be parsed.
+func Start(enabled bool, asJSON bool) func() {
+	SetDryRun(enabled)
+	if !enabled {
+		return func() {}
+	}
+	out := os.Stdout
+	if asJSON {
+		os.Stdout = os.Stderr
+	}
+	return func() {
+		if err := Print(out, asJSON); err != nil {
+			log.Println(err)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/cmd"
+	"github.com/antuspenskiy/automate-vhosts/pkg/plan"
+)
+
+// Statuses of pm2 process
+const (
+	StatusOnline    = "online"
+	StatusLaunching = "launching"
+	StatusStopping  = "stopping"
+	StatusStopped   = "stopped"
+	StatusErrored   = "errored"
+)
+
+// DefaultUser runs pm2 daemon of virtual hosts
+const DefaultUser = "user"
+
+// defaultStableFor is time process stays online before WaitOnline returns
+const defaultStableFor = 5 * time.Second
+
+// ErrNotFound is returned when pm2 has no process with name
+var ErrNotFound = errors.New("pm2 process not found")
+
+// Process is pm2 process parsed from pm2 jlist
+type Process struct {
+	Name   string `json:"name"`
+	PID    int    `json:"pid"`
+	Status string `json:"status"`
+	// Restarts is number of restarts, it grows when application crash-loops
+	Restarts int `json:"restarts"`
+	// Memory is resident memory in bytes
+	Memory int64 `json:"memory"`
+	// CPU is usage in percents
+	CPU float64 `json:"cpu"`
+	// Uptime is start time of process, zero if it is not running
+	Uptime time.Time `json:"uptime,omitempty"`
+}
+
+// Online returns true if process is running
+func (p *Process) Online() bool {
+	return p.Status == StatusOnline
+}
+
+// jlistProcess is an item of pm2 jlist output
+type jlistProcess struct {
+	Name   string `json:"name"`
+	PID    int    `json:"pid"`
+	PM2Env struct {
+		Status      string `json:"status"`
+		RestartTime int    `json:"restart_time"`
+		PMUptime    int64  `json:"pm_uptime"`
+	} `json:"pm2_env"`
+	Monit struct {
+		Memory int64   `json:"memory"`
+		CPU    float64 `json:"cpu"`
+	} `json:"monit"`
+}
+
+// ParseJList returns processes of pm2 jlist output
+func ParseJList(data []byte) ([]Process, error) {
+	var items []jlistProcess
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("parse pm2 jlist: %v", err)
+	}
+	processes := make([]Process, 0, len(items))
+	for _, item := range items {
+		p := Process{
+			Name:     item.Name,
+			PID:      item.PID,
+			Status:   item.PM2Env.Status,
+			Restarts: item.PM2Env.RestartTime,
+			Memory:   item.Monit.Memory,
+			CPU:      item.Monit.CPU,
+		}
+		if p.Online() && item.PM2Env.PMUptime > 0 {
+			p.Uptime = time.Unix(0, item.PM2Env.PMUptime*int64(time.Millisecond))
+		}
+		processes = append(processes, p)
+	}
+	return processes, nil
+}
+
+// PM2 is a client of pm2 daemon of User
+type PM2 struct {
+	// User runs pm2 with sudo, pm2 runs as current user if empty
+	User string
+	// Interval between checks of WaitOnline, one second if zero
+	Interval time.Duration
+	// StableFor is time process stays online without restarts before
+	// WaitOnline returns, five seconds if zero
+	StableFor time.Duration
+}
+
+// NewPM2 returns client of pm2 daemon of DefaultUser
+func NewPM2() *PM2 {
+	return &PM2{User: DefaultUser}
+}
+
+func (c *PM2) argv(args ...string) (string, []string) {
+	if c.User == "" {
+		return "pm2", args
+	}
+	return "sudo", append([]string{"-u", c.User, "pm2"}, args...)
+}
+
+// List returns all processes of pm2, it is run in dry-run mode too
+func (c *PM2) List(ctx context.Context) ([]Process, error) {
+	name, args := c.argv("jlist")
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("pm2 jlist: %v", err)
+	}
+	return ParseJList(out)
+}
+
+// Describe returns process by name, ErrNotFound if pm2 has no such process
+func (c *PM2) Describe(ctx context.Context, name string) (*Process, error) {
+	processes, err := c.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range processes {
+		if processes[i].Name == name {
+			return &processes[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// Start start processes of pm2 json configuration
+func (c *PM2) Start(ctx context.Context, path string) error {
+	name, args := c.argv("start", path)
+	return cmd.ExecContext(ctx, "", name, args...)
+}
+
+// Delete stop and delete process, missing process is not an error
+func (c *PM2) Delete(ctx context.Context, name string) error {
+	if _, err := c.Describe(ctx, name); errors.Is(err, ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	bin, args := c.argv("delete", "-s", name)
+	return cmd.ExecContext(ctx, "", bin, args...)
+}
+
+// WaitOnline wait until process is online and its restart count is not
+// changed for StableFor, so crash-looping process is not reported online.
+// Returns error if process is errored, stopped or not stable before timeout,
+// it is not checked in dry-run mode because process is not started then.
+func (c *PM2) WaitOnline(ctx context.Context, name string, timeout time.Duration) (*Process, error) {
+	if plan.DryRun() {
+		return nil, nil
+	}
+	interval := c.Interval
+	if interval == 0 {
+		interval = time.Second
+	}
+	stableFor := c.StableFor
+	if stableFor == 0 {
+		stableFor = defaultStableFor
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// onlineSince is reset when process leaves online status or restarts
+	var last *Process
+	var onlineSince time.Time
+	for {
+		p, err := c.Describe(ctx, name)
+		if p != nil {
+			if !p.Online() || last == nil || p.Restarts != last.Restarts {
+				onlineSince = time.Time{}
+			}
+			if p.Online() && onlineSince.IsZero() {
+				onlineSince = time.Now()
+			}
+			last = p
+		}
+		switch {
+		case err != nil && !errors.Is(err, ErrNotFound) && ctx.Err() == nil:
+			return nil, err
+		case p != nil && p.Online() && time.Since(onlineSince) >= stableFor:
+			return p, nil
+		case p != nil && (p.Status == StatusErrored || p.Status == StatusStopped):
+			return p, fmt.Errorf("pm2 process %s is %s after %d restarts", name, p.Status, p.Restarts)
+		}
+
+		select {
+		case <-ctx.Done():
+			if last == nil {
+				return nil, fmt.Errorf("pm2 process %s is not started in %s", name, timeout)
+			}
+			if last.Online() {
+				return last, fmt.Errorf("pm2 process %s is not stable in %s, %d restarts", name, timeout, last.Restarts)
+			}
+			return last, fmt.Errorf("pm2 process %s is %s, not online in %s, %d restarts", name, last.Status, timeout, last.Restarts)
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJList(t *testing.T) {
+	uptime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name  string
+		jlist string
+		want  []Process
+		err   bool
+	}{
+		{
+			name:  "empty",
+			jlist: `[]`,
+			want:  []Process{},
+		},
+		{
+			name: "online and errored",
+			jlist: fmt.Sprintf(`[
+				{"name": "feature-a", "pid": 1234, "pm2_env": {"status": "online", "restart_time": 2, "pm_uptime": %d}, "monit": {"memory": 52428800, "cpu": 1.5}},
+				{"name": "feature-b", "pid": 0, "pm2_env": {"status": "errored", "restart_time": 15, "pm_uptime": %d}, "monit": {"memory": 0, "cpu": 0}}
+			]`, uptime.UnixNano()/int64(time.Millisecond), uptime.UnixNano()/int64(time.Millisecond)),
+			want: []Process{
+				{Name: "feature-a", PID: 1234, Status: StatusOnline, Restarts: 2, Memory: 52428800, CPU: 1.5, Uptime: uptime},
+				{Name: "feature-b", Status: StatusErrored, Restarts: 15},
+			},
+		},
+		{
+			name:  "unknown fields",
+			jlist: `[{"name": "feature-c", "pm2_env": {"status": "stopped", "versioning": null}, "axm_monitor": {}}]`,
+			want:  []Process{{Name: "feature-c", Status: StatusStopped}},
+		},
+		{
+			name:  "not json",
+			jlist: "[PM2] Spawning PM2 daemon",
+			err:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseJList([]byte(tt.jlist))
+			if tt.err {
+				if err == nil {
+					t.Errorf("ParseJList = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Uptime is compared as instant, location of parsed time differs
+			for i := range got {
+				if i < len(tt.want) && got[i].Uptime.Equal(tt.want[i].Uptime) {
+					got[i].Uptime = tt.want[i].Uptime
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseJList = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakePM2 install pm2 script which prints the next of states on every jlist,
+// the last state is repeated
+func fakePM2(t *testing.T, states ...string) {
+	t.Helper()
+	dir := t.TempDir()
+	for i, state := range states {
+		jlist := "[]"
+		if state != "" {
+			fields := strings.Fields(state)
+			jlist = fmt.Sprintf(`[{"name": "app", "pid": 1, "pm2_env": {"status": %q, "restart_time": %s}}]`, fields[0], fields[1])
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("state%d", i)), []byte(jlist), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	script := fmt.Sprintf(`#!/bin/sh
+n=$(cat %[1]s/calls 2>/dev/null || echo 0)
+[ "$n" -lt %[2]d ] || n=%[2]d
+echo $((n + 1)) > %[1]s/calls
+cat %[1]s/state$n
+`, dir, len(states)-1)
+	if err := ioutil.WriteFile(filepath.Join(dir, "pm2"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestWaitOnline(t *testing.T) {
+	tests := []struct {
+		name     string
+		states   []string
+		restarts int
+		err      string
+	}{
+		{
+			name:     "stable",
+			states:   []string{"", "launching 0", "online 0"},
+			restarts: 0,
+		},
+		{
+			name:     "restarted once",
+			states:   []string{"online 0", "online 1", "online 1"},
+			restarts: 1,
+		},
+		{
+			name:   "crash loop",
+			states: []string{"online 0", "launching 1", "online 1", "online 2", "launching 3", "online 3", "online 4", "online 5", "online 6", "online 7", "online 8", "online 9", "online 10"},
+			err:    "is not stable",
+		},
+		{
+			name:   "errored",
+			states: []string{"online 0", "errored 15"},
+			err:    "is errored after 15 restarts",
+		},
+		{
+			name:   "not started",
+			states: []string{""},
+			err:    "is not started",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakePM2(t, tt.states...)
+			pm2 := &PM2{Interval: 20 * time.Millisecond, StableFor: 50 * time.Millisecond}
+			p, err := pm2.WaitOnline(context.Background(), "app", 250*time.Millisecond)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("WaitOnline = %+v, %v, want error %q", p, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !p.Online() || p.Restarts != tt.restarts {
+				t.Errorf("WaitOnline = %+v, want online with %d restarts", p, tt.restarts)
+			}
+		})
+	}
+}
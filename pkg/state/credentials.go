@@ -0,0 +1,111 @@
+package state
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/plan"
+)
+
+const (
+	passwordLength  = 24
+	passwordCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// Credentials of virtual host MySQL user, stored in a file readable only by owner
+type Credentials struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+func (s *Store) credentialsPath(refSlug string) string {
+	return filepath.Join(s.Dir, refSlug+".secret")
+}
+
+// LoadCredentials read credentials of virtual host, error satisfies
+// os.IsNotExist if they weren't generated yet
+func (s *Store) LoadCredentials(refSlug string) (*Credentials, error) {
+	data, err := ioutil.ReadFile(s.credentialsPath(refSlug))
+	if err != nil {
+		return nil, err
+	}
+	c := &Credentials{}
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Credentials returns credentials of virtual host. Password is generated once
+// per refslug and reused by every command, until RemoveCredentials. If there
+// are no credentials yet and legacyPassword is set, it is adopted instead, so
+// virtual hosts created before keep password of their configuration files.
+func (s *Store) Credentials(refSlug, user, legacyPassword string) (*Credentials, error) {
+	c, err := s.LoadCredentials(refSlug)
+	if err == nil && c.User == user {
+		return c, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	password, detail := legacyPassword, "legacy password of"
+	if err == nil || password == "" {
+		if password, err = GeneratePassword(passwordLength); err != nil {
+			return nil, err
+		}
+		detail = "new password for"
+	}
+	c = &Credentials{User: user, Password: password}
+
+	// Password isn't saved in dry-run mode, plan shows it is generated
+	if plan.Record(plan.Write, "%s, %s %s", s.credentialsPath(refSlug), detail, user) {
+		return c, nil
+	}
+	if err = os.MkdirAll(s.Dir, 0750); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	tmp := s.credentialsPath(refSlug) + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tmp, s.credentialsPath(refSlug)); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// RemoveCredentials delete credentials of virtual host
+func (s *Store) RemoveCredentials(refSlug string) error {
+	if plan.Record(plan.Remove, "%s", s.credentialsPath(refSlug)) {
+		return nil
+	}
+	err := os.Remove(s.credentialsPath(refSlug))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// GeneratePassword returns random alphanumeric password, safe to put in
+// configuration files without escaping
+func GeneratePassword(length int) (string, error) {
+	max := big.NewInt(int64(len(passwordCharset)))
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = passwordCharset[n.Int64()]
+	}
+	return string(b), nil
+}
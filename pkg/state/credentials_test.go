@@ -0,0 +1,123 @@
+package state
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCredentials(t *testing.T) {
+	tests := []struct {
+		name           string
+		stored         *Credentials
+		user           string
+		legacyPassword string
+		// want is expected password, generated one if empty
+		want string
+	}{
+		{
+			name: "new virtual host",
+			user: "feature_a",
+		},
+		{
+			name:           "legacy virtual host",
+			user:           "feature_a",
+			legacyPassword: "feature_a",
+			want:           "feature_a",
+		},
+		{
+			name:           "stored password is kept",
+			stored:         &Credentials{User: "feature_a", Password: "stored"},
+			user:           "feature_a",
+			legacyPassword: "feature_a",
+			want:           "stored",
+		},
+		{
+			name:           "renamed user gets new password",
+			stored:         &Credentials{User: "feature_a", Password: "stored"},
+			user:           "feature_a_1234abcd",
+			legacyPassword: "feature_a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStore(t.TempDir())
+			if tt.stored != nil {
+				if _, err := s.Credentials("feature-a", tt.stored.User, tt.stored.Password); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			c, err := s.Credentials("feature-a", tt.user, tt.legacyPassword)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.User != tt.user {
+				t.Errorf("user = %s, want %s", c.User, tt.user)
+			}
+			if tt.want != "" && c.Password != tt.want {
+				t.Errorf("password = %s, want %s", c.Password, tt.want)
+			}
+			if tt.want == "" && (len(c.Password) != passwordLength || c.Password == tt.legacyPassword || (tt.stored != nil && c.Password == tt.stored.Password)) {
+				t.Errorf("password = %s, want new generated one", c.Password)
+			}
+
+			// The same credentials are returned by every command
+			again, err := s.Credentials("feature-a", tt.user, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *again != *c {
+				t.Errorf("credentials of the next run = %+v, want %+v", again, c)
+			}
+			info, err := os.Stat(s.credentialsPath("feature-a"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("credentials file mode = %v, want 0600", info.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestRemoveCredentials(t *testing.T) {
+	s := NewStore(t.TempDir())
+	if err := s.RemoveCredentials("feature-a"); err != nil {
+		t.Errorf("RemoveCredentials of missing file = %v", err)
+	}
+	c, err := s.Credentials("feature-a", "feature_a", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.RemoveCredentials("feature-a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.LoadCredentials("feature-a"); !os.IsNotExist(err) {
+		t.Errorf("LoadCredentials after remove = %v, want not exist", err)
+	}
+	next, err := s.Credentials("feature-a", "feature_a", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Password == c.Password {
+		t.Errorf("password is reused after RemoveCredentials")
+	}
+}
+
+func TestGeneratePassword(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		p, err := GeneratePassword(passwordLength)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p) != passwordLength || strings.Trim(p, passwordCharset) != "" {
+			t.Fatalf("password %q is not %d alphanumeric characters", p, passwordLength)
+		}
+		if seen[p] {
+			t.Fatalf("password %q is generated twice", p)
+		}
+		seen[p] = true
+	}
+}
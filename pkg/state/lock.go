@@ -0,0 +1,52 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/plan"
+)
+
+// Lock is exclusive lock of virtual host manifest
+type Lock struct {
+	f *os.File
+}
+
+func (s *Store) lockPath(refSlug string) string {
+	return filepath.Join(s.Dir, refSlug+".lock")
+}
+
+// Lock take exclusive lock of virtual host until Unlock. Commands for the same
+// refslug wait for each other, so they don't overwrite fields of manifest
+// saved by another one. Lock file isn't created in dry-run mode.
+func (s *Store) Lock(refSlug string) (*Lock, error) {
+	l := &Lock{}
+	if plan.DryRun() {
+		return l, nil
+	}
+	if err := os.MkdirAll(s.Dir, 0750); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(s.lockPath(refSlug), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock state of %s: %v", refSlug, err)
+	}
+	l.f = f
+	return l, nil
+}
+
+// Unlock release lock of virtual host
+func (l *Lock) Unlock() error {
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
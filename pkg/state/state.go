@@ -0,0 +1,160 @@
+package state
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/plan"
+)
+
+// DefaultDir used when env.json doesn't set statedir
+const DefaultDir = "/var/lib/automate-vhosts/state"
+
+// Manifest records everything provisioned for a virtual host
+type Manifest struct {
+	RefSlug      string            `json:"refslug"`
+	Profile      string            `json:"profile,omitempty"`
+	HostDir      string            `json:"host_dir,omitempty"`
+	CommitSHA    string            `json:"commit_sha,omitempty"`
+	DBName       string            `json:"db_name,omitempty"`
+	DBUser       string            `json:"db_user,omitempty"`
+	Ports        map[string]int    `json:"ports,omitempty"`
+	Configs      map[string]string `json:"configs,omitempty"`
+	PM2App       string            `json:"pm2_app,omitempty"`
+	Unit         string            `json:"unit,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+	DeployedAt   *time.Time        `json:"deployed_at,omitempty"`
+	ConfiguredAt *time.Time        `json:"configured_at,omitempty"`
+	ImportedAt   *time.Time        `json:"imported_at,omitempty"`
+}
+
+// SetConfig record path of generated configuration file by name (nginx, fpm, pm2, ...)
+func (m *Manifest) SetConfig(name, path string) {
+	if m.Configs == nil {
+		m.Configs = make(map[string]string)
+	}
+	m.Configs[name] = path
+}
+
+// SetPort record port allocated for service
+func (m *Manifest) SetPort(service string, port int) {
+	if m.Ports == nil {
+		m.Ports = make(map[string]int)
+	}
+	m.Ports[service] = port
+}
+
+// Store keeps one JSON manifest per virtual host in directory
+type Store struct {
+	Dir string
+}
+
+// NewStore returns store for directory, DefaultDir if dir is empty
+func NewStore(dir string) *Store {
+	if dir == "" {
+		dir = DefaultDir
+	}
+	return &Store{Dir: dir}
+}
+
+func (s *Store) path(refSlug string) string {
+	return filepath.Join(s.Dir, refSlug+".json")
+}
+
+// Load read manifest of virtual host, error satisfies os.IsNotExist if there is no manifest
+func (s *Store) Load(refSlug string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(s.path(refSlug))
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Open read manifest of virtual host or returns a new one if it doesn't exist
+func (s *Store) Open(refSlug string) (*Manifest, error) {
+	m, err := s.Load(refSlug)
+	if os.IsNotExist(err) {
+		return &Manifest{RefSlug: refSlug}, nil
+	}
+	return m, err
+}
+
+// Save write manifest, through temporary file and rename
+func (s *Store) Save(m *Manifest) error {
+	now := time.Now()
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = now
+	}
+	m.UpdatedAt = now
+
+	data, err := json.MarshalIndent(m, "", " ")
+	if err != nil {
+		return err
+	}
+	if plan.Record(plan.Write, "%s, %d bytes", s.path(m.RefSlug), len(data)) {
+		return nil
+	}
+	if err = os.MkdirAll(s.Dir, 0750); err != nil {
+		return err
+	}
+	tmp := s.path(m.RefSlug) + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(m.RefSlug))
+}
+
+// List returns manifests of all virtual hosts sorted by refslug
+func (s *Store) List() ([]*Manifest, error) {
+	files, err := ioutil.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []*Manifest
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		m, err := s.Load(strings.TrimSuffix(f.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, m)
+	}
+	sort.Slice(manifests, func(i, j int) bool {
+		return manifests[i].RefSlug < manifests[j].RefSlug
+	})
+	return manifests, nil
+}
+
+// Remove delete manifest of virtual host
+func (s *Store) Remove(refSlug string) error {
+	if plan.Record(plan.Remove, "%s", s.path(refSlug)) {
+		return nil
+	}
+	err := os.Remove(s.path(refSlug))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Now returns pointer to current time for manifest timestamps
+func Now() *time.Time {
+	t := time.Now()
+	return &t
+}
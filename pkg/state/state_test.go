@@ -0,0 +1,109 @@
+package state
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	s := NewStore(t.TempDir())
+
+	m, err := s.Open("feature-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.RefSlug != "feature-b" || !m.CreatedAt.IsZero() {
+		t.Errorf("Open of new virtual host = %+v", m)
+	}
+	m.DBName = "feature_b"
+	m.SetPort("php", 8081)
+	m.SetConfig("nginx", "/etc/nginx/conf.d/feature-b.conf")
+	if err = s.Save(m); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Save(&Manifest{RefSlug: "feature-a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lock and credentials files are not manifests
+	if _, err = s.Credentials("feature-a", "feature_a", ""); err != nil {
+		t.Fatal(err)
+	}
+	l, err := s.Lock("feature-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Unlock()
+
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].RefSlug != "feature-a" || list[1].RefSlug != "feature-b" {
+		t.Fatalf("List = %+v, want feature-a and feature-b", list)
+	}
+	loaded := list[1]
+	if loaded.DBName != "feature_b" || loaded.Ports["php"] != 8081 || loaded.Configs["nginx"] == "" || loaded.CreatedAt.IsZero() {
+		t.Errorf("loaded manifest = %+v", loaded)
+	}
+
+	if err = s.Remove("feature-b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Load("feature-b"); !os.IsNotExist(err) {
+		t.Errorf("Load after Remove = %v, want not exist", err)
+	}
+	if err = s.Remove("feature-b"); err != nil {
+		t.Errorf("Remove of missing manifest = %v", err)
+	}
+}
+
+func TestStoreListMissingDir(t *testing.T) {
+	list, err := NewStore(t.TempDir() + "/missing").List()
+	if err != nil || len(list) != 0 {
+		t.Errorf("List of missing directory = %+v, %v", list, err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	s := NewStore(t.TempDir())
+	l, err := s.Lock("feature-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another refslug is not blocked
+	other, err := s.Lock("feature-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Unlock()
+
+	// The same refslug waits until Unlock
+	locked := make(chan *Lock)
+	go func() {
+		l2, err := s.Lock("feature-a")
+		if err != nil {
+			t.Error(err)
+		}
+		locked <- l2
+	}()
+	select {
+	case <-locked:
+		t.Fatal("second lock of feature-a is taken before Unlock")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err = l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case l2 := <-locked:
+		l2.Unlock()
+	case <-time.After(5 * time.Second):
+		t.Fatal("second lock of feature-a is not taken after Unlock")
+	}
+	if err = l.Unlock(); err != nil {
+		t.Errorf("second Unlock = %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+package vhost
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/cmd"
+	"github.com/antuspenskiy/automate-vhosts/pkg/config"
+	"github.com/antuspenskiy/automate-vhosts/pkg/process"
+	"github.com/antuspenskiy/automate-vhosts/pkg/state"
+)
+
+// defaultPM2Timeout is time to wait until pm2 process is online, changed by
+// "server.pm2-timeout" of env.json
+const defaultPM2Timeout = time.Minute
+
+// ConfigureServices reserve ports for services of profile, write nginx,
+// php-fpm and pm2 configuration and start pm2 process. Created files, new
+// ports and started process are removed if any step fails.
+func ConfigureServices(ctx context.Context, o Options) (*state.Manifest, error) {
+	t := &task{op: OpConfigure, refSlug: o.RefSlug}
+	var m *state.Manifest
+	err := t.run(&o, func() error {
+		var err error
+		if m, err = o.store().Open(o.RefSlug); err != nil {
+			return t.fail("state", err)
+		}
+		m.Profile = o.Profile.Name
+		m.HostDir = o.hostDir()
+
+		portsOf, err := reservePorts(t, &o, m)
+		if err != nil {
+			return err
+		}
+
+		// Create configuration files of profile artifacts: nginx, php-fpm, pm2
+		params := &config.Params{
+			RefSlug:    o.RefSlug,
+			HostDir:    m.HostDir,
+			ServerName: fmt.Sprintf("%s.%s", o.RefSlug, o.Conf.GetString("subdomain")),
+			Ports:      portsOf,
+			Profile:    o.Profile,
+			Conf:       o.Conf,
+			Changes:    t.changes,
+		}
+		artifacts, err := config.GenerateArtifacts(config.StageConfigs, params)
+
+		// Files created by this run are removed on failure, their services are
+		// reloaded without them at the end of the run
+		for _, artifact := range artifacts {
+			if artifact.Created {
+				file, service := artifact.Target.Path, config.ArtifactService(artifact.Name)
+				t.Undo("remove "+file, func() error {
+					if service != "" {
+						t.changes.MarkChanged(service)
+					}
+					return cmd.RemoveAll(file)
+				})
+			}
+		}
+		if err != nil {
+			return t.fail("artifacts", err)
+		}
+
+		for _, artifact := range artifacts {
+			if artifact.Created {
+				log.Printf("Configuration %s %s created\n", artifact.Name, artifact.Target.Path)
+			} else {
+				log.Printf("Configuration %s %s exist!\n", artifact.Name, artifact.Target.Path)
+			}
+			m.SetConfig(artifact.Name, artifact.Target.Path)
+
+			switch artifact.Name {
+			case "pm2":
+				m.PM2App = o.RefSlug
+				if err = startPM2(ctx, t, &o, artifact); err != nil {
+					return t.fail("pm2", err)
+				}
+			case "systemd":
+				m.Unit = config.UnitName(o.RefSlug)
+				if err = startUnit(ctx, t, m.Unit, artifact); err != nil {
+					return t.fail("systemd", err)
+				}
+			}
+		}
+
+		m.ConfiguredAt = state.Now()
+		if err = o.store().Save(m); err != nil {
+			return t.fail("state", err)
+		}
+		log.Printf("State of %s saved\n", o.RefSlug)
+		return nil
+	})
+	return m, err
+}
+
+// reservePorts returns ports of profile services from port registry, the same
+// ports are returned on every run for refslug
+func reservePorts(t *task, o *Options, m *state.Manifest) (map[string]int, error) {
+	ports, err := config.OpenPortRegistryFromConfig(o.Conf)
+	if err != nil {
+		return nil, t.fail("ports", err)
+	}
+	defer ports.Close()
+
+	// Adopt ports of virtual hosts configured before the registry, port of
+	// configuration allocated for another virtual host is a conflict
+	fpmConf := filepath.Join(o.Conf.GetString("fpmdir"), o.RefSlug+".conf")
+	pm2Conf := filepath.Join(o.Conf.GetString("server.pm2"), o.RefSlug+".json")
+	if _, ok := ports.Lookup(o.RefSlug, config.PortPhp); !ok && cmd.DirectoryExists(fpmConf) {
+		if port, err := config.FpmListenPort(fpmConf); err == nil {
+			if err = ports.Assign(o.RefSlug, config.PortPhp, port); err != nil {
+				return nil, t.fail("ports", err)
+			}
+		}
+	}
+	if _, ok := ports.Lookup(o.RefSlug, config.PortNode); !ok && cmd.DirectoryExists(pm2Conf) {
+		if port, err := config.PM2Port(pm2Conf); err == nil {
+			if err = ports.Assign(o.RefSlug, config.PortNode, port); err != nil {
+				return nil, t.fail("ports", err)
+			}
+		}
+	}
+	unitConf := config.UnitPath(o.Conf, o.RefSlug)
+	if _, ok := ports.Lookup(o.RefSlug, config.PortNode); !ok && cmd.DirectoryExists(unitConf) {
+		if port, err := config.SystemdPort(unitConf); err == nil {
+			if err = ports.Assign(o.RefSlug, config.PortNode, port); err != nil {
+				return nil, t.fail("ports", err)
+			}
+		}
+	}
+	// Existing nginx configuration is kept, so its upstream ports are adopted
+	// when php-fpm pool or pm2 configuration is missing or not parsed
+	nginxConf := filepath.Join(o.Conf.GetString("nginxdir"), o.RefSlug+".conf")
+	if cmd.DirectoryExists(nginxConf) {
+		if nginxPorts, err := config.NginxPorts(nginxConf); err == nil {
+			for _, service := range []string{config.PortPhp, config.PortNode} {
+				port, found := nginxPorts[service]
+				if _, ok := ports.Lookup(o.RefSlug, service); ok || !found || port == 0 {
+					continue
+				}
+				if err = ports.Assign(o.RefSlug, service, port); err != nil {
+					return nil, t.fail("ports", err)
+				}
+			}
+		}
+	}
+
+	// Reserve ports only for services of profile
+	portsOf := make(map[string]int)
+	var reserved []string
+	for _, service := range o.Profile.Services {
+		_, ok := ports.Lookup(o.RefSlug, service)
+		port, err := ports.Reserve(o.RefSlug, service)
+		if err != nil {
+			return nil, t.fail("ports", err)
+		}
+		if !ok {
+			reserved = append(reserved, service)
+		}
+		portsOf[service] = port
+		m.SetPort(service, port)
+		log.Printf("Port of %s for %s: %d\n", service, o.RefSlug, port)
+	}
+	if err = ports.Save(); err != nil {
+		return nil, t.fail("ports", err)
+	}
+
+	// Registry is unlocked when ports are reserved, it is opened again to free
+	// new ports on failure
+	if len(reserved) > 0 {
+		t.Undo(fmt.Sprintf("free %v ports", reserved), func() error {
+			ports, err := config.OpenPortRegistryFromConfig(o.Conf)
+			if err != nil {
+				return err
+			}
+			defer ports.Close()
+			for _, service := range reserved {
+				ports.Free(o.RefSlug, service)
+			}
+			return ports.Save()
+		})
+	}
+	return portsOf, nil
+}
+
+// startPM2 start pm2 process from configuration and wait until it is online,
+// process of existing configuration is deleted and started again instead of
+// reload
+func startPM2(ctx context.Context, t *task, o *Options, artifact config.Artifact) error {
+	pm2 := process.NewPM2()
+	refSlug := o.RefSlug
+	if !artifact.Created {
+		if err := pm2.Delete(ctx, refSlug); err != nil {
+			return err
+		}
+	}
+	if err := pm2.Start(ctx, artifact.Target.Path); err != nil {
+		return err
+	}
+	if artifact.Created {
+		t.Undo("delete pm2 process "+refSlug, func() error {
+			return pm2.Delete(context.Background(), refSlug)
+		})
+	}
+
+	timeout := o.Conf.GetDuration("server.pm2-timeout")
+	if timeout == 0 {
+		timeout = defaultPM2Timeout
+	}
+	p, err := pm2.WaitOnline(ctx, refSlug, timeout)
+	if err != nil {
+		return err
+	}
+	if p != nil {
+		log.Printf("pm2 process %s is online, pid %d, %d restarts, memory %d MB\n", p.Name, p.PID, p.Restarts, p.Memory>>20)
+	}
+	return nil
+}
+
+// startUnit start systemd unit of node application, unit of existing
+// configuration is restarted
+func startUnit(ctx context.Context, t *task, unit string, artifact config.Artifact) error {
+	if err := config.StartUnit(ctx, unit, artifact.Created); err != nil {
+		return err
+	}
+	if artifact.Created {
+		t.Undo("stop unit "+unit, func() error {
+			return config.StopUnit(context.Background(), unit)
+		})
+	}
+	return nil
+}
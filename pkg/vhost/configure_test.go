@@ -0,0 +1,149 @@
+package vhost
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/config"
+	"github.com/antuspenskiy/automate-vhosts/pkg/state"
+	"github.com/spf13/viper"
+)
+
+// testOptions returns options of refslug with configuration directories in
+// temporary directory
+func testOptions(t *testing.T, refSlug string, services ...string) *Options {
+	t.Helper()
+	dir := t.TempDir()
+	conf := viper.New()
+	for key, sub := range map[string]string{
+		"rootdir":        "web",
+		"nginxdir":       "nginx",
+		"fpmdir":         "fpm",
+		"server.pm2":     "pm2json",
+		"server.systemd": "systemd",
+	} {
+		path := filepath.Join(dir, sub)
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+		conf.Set(key, path)
+	}
+	conf.Set("statedir", filepath.Join(dir, "state"))
+	conf.Set("portregistry", filepath.Join(dir, "ports.json"))
+	conf.Set("ports", map[string]interface{}{
+		"php":  map[string]interface{}{"min": 38500, "max": 38599},
+		"node": map[string]interface{}{"min": 38600, "max": 38699},
+	})
+	return &Options{
+		RefSlug: refSlug,
+		Conf:    conf,
+		Profile: &config.Profile{Name: "test", Services: services},
+	}
+}
+
+func writeConf(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const nginxConf = `server {
+    server_name feature-a.example.com;
+    location ~ \.php$ {
+        fastcgi_pass 127.0.0.1:8123;
+    }
+    location /node/ {
+        proxy_pass http://127.0.0.1:8124;
+    }
+}
+`
+
+func TestReservePortsAdoptsExisting(t *testing.T) {
+	tests := []struct {
+		name  string
+		fpm   string
+		pm2   string
+		nginx string
+		want  map[string]int
+	}{
+		{
+			name:  "nginx without php-fpm pool and pm2",
+			nginx: nginxConf,
+			want:  map[string]int{config.PortPhp: 8123, config.PortNode: 8124},
+		},
+		{
+			name:  "nginx with broken php-fpm pool",
+			fpm:   "[feature-a]\nlisten = broken\n",
+			nginx: nginxConf,
+			want:  map[string]int{config.PortPhp: 8123, config.PortNode: 8124},
+		},
+		{
+			name:  "php-fpm pool and pm2 win over nginx",
+			fpm:   "[feature-a]\nlisten = 127.0.0.1:8200\n",
+			pm2:   `{"apps": [{"name": "feature-a", "env": {"PORT": 8201}}]}`,
+			nginx: nginxConf,
+			want:  map[string]int{config.PortPhp: 8200, config.PortNode: 8201},
+		},
+		{
+			name: "new virtual host",
+			want: map[string]int{config.PortPhp: 38500, config.PortNode: 38600},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := testOptions(t, "feature-a", config.PortPhp, config.PortNode)
+			if tt.fpm != "" {
+				writeConf(t, o.Conf.GetString("fpmdir"), "feature-a.conf", tt.fpm)
+			}
+			if tt.pm2 != "" {
+				writeConf(t, o.Conf.GetString("server.pm2"), "feature-a.json", tt.pm2)
+			}
+			if tt.nginx != "" {
+				writeConf(t, o.Conf.GetString("nginxdir"), "feature-a.conf", tt.nginx)
+			}
+			if tt.nginx == "" && (!config.IsTCPPortAvailable(38500) || !config.IsTCPPortAvailable(38600)) {
+				t.Skip("ports of range are busy")
+			}
+
+			m := &state.Manifest{RefSlug: o.RefSlug}
+			got, err := reservePorts(&task{op: OpConfigure, refSlug: o.RefSlug}, o, m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ports = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(m.Ports, tt.want) {
+				t.Errorf("ports of manifest = %v, want %v", m.Ports, tt.want)
+			}
+		})
+	}
+}
+
+func TestReservePortsConflict(t *testing.T) {
+	o := testOptions(t, "feature-a", config.PortPhp)
+	writeConf(t, o.Conf.GetString("nginxdir"), "feature-a.conf", nginxConf)
+
+	// Port of nginx configuration is allocated for another virtual host
+	ports, err := config.OpenPortRegistryFromConfig(o.Conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ports.Assign("feature-b", config.PortPhp, 8123); err != nil {
+		t.Fatal(err)
+	}
+	if err = ports.Save(); err != nil {
+		t.Fatal(err)
+	}
+	ports.Close()
+
+	_, err = reservePorts(&task{op: OpConfigure, refSlug: o.RefSlug}, o, &state.Manifest{RefSlug: o.RefSlug})
+	if !errors.Is(err, config.ErrPortOwned) {
+		t.Errorf("reservePorts = %v, want ErrPortOwned", err)
+	}
+}
@@ -0,0 +1,219 @@
+package vhost
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/cmd"
+	"github.com/antuspenskiy/automate-vhosts/pkg/config"
+	"github.com/antuspenskiy/automate-vhosts/pkg/git"
+	"github.com/antuspenskiy/automate-vhosts/pkg/plan"
+	"github.com/antuspenskiy/automate-vhosts/pkg/state"
+)
+
+// Create make virtual host directory, write environment artifacts of profile,
+// checkout commit and run deploy steps of the first deploy. Directory is
+// removed if any step fails.
+func Create(ctx context.Context, o Options) (*state.Manifest, error) {
+	t := &task{op: OpCreate, refSlug: o.RefSlug}
+	var m *state.Manifest
+	err := t.run(&o, func() error {
+		hostDir := o.hostDir()
+		if cmd.DirectoryExists(hostDir) {
+			return t.fail("mkdir", ErrExists)
+		}
+
+		var creds *state.Credentials
+		var err error
+		if m, creds, err = openEnv(t, &o); err != nil {
+			return err
+		}
+
+		log.Printf("Create directory %s.\n\n", hostDir)
+		if err = cmd.Mkdir(hostDir, 0750); err != nil {
+			return t.fail("mkdir", err)
+		}
+		// Half-created directory is removed on failure, otherwise the next
+		// run would take it for existing virtual host
+		t.Undo("remove "+hostDir, func() error { return cmd.RemoveAll(hostDir) })
+
+		// Create configuration files of profile artifacts, like node library
+		// env.json and Laravel .env, they are needed before deploy commands
+		params := &config.Params{
+			RefSlug:    o.RefSlug,
+			HostDir:    hostDir,
+			DBName:     m.DBName,
+			DBUser:     creds.User,
+			DBPassword: creds.Password,
+			Profile:    o.Profile,
+			Conf:       o.Conf,
+			Changes:    t.changes,
+		}
+		artifacts, err := config.GenerateArtifacts(config.StageEnv, params)
+		if err != nil {
+			return t.fail("artifacts", err)
+		}
+		for _, artifact := range artifacts {
+			m.SetConfig(artifact.Name, artifact.Target.Path)
+			log.Printf("Configuration %s %s created\n", artifact.Name, artifact.Target.Path)
+		}
+
+		auth, err := o.gitAuth()
+		if err != nil {
+			return t.fail("checkout", err)
+		}
+		repo, err := git.Init(ctx, hostDir, o.Conf.GetString("server.giturl"), o.RefSlug, auth)
+		if err != nil {
+			return t.fail("fetch", err)
+		}
+		if err = repo.Checkout(ctx, o.CommitSHA, false); err != nil {
+			return t.fail("checkout", err)
+		}
+
+		if err = deploy(ctx, &o, cmd.WhenCreate); err != nil {
+			return t.fail("deploy", err)
+		}
+		return finishEnv(ctx, t, &o, m, creds)
+	})
+	return m, err
+}
+
+// Update fetch and checkout commit in existing virtual host directory and run
+// deploy steps of update. Checkout fails with git.ErrNonFastForward or
+// git.ErrDirtyWorktree unless o.Force is set.
+func Update(ctx context.Context, o Options) (*state.Manifest, error) {
+	t := &task{op: OpUpdate, refSlug: o.RefSlug}
+	var m *state.Manifest
+	err := t.run(&o, func() error {
+		hostDir := o.hostDir()
+		if !cmd.DirectoryExists(hostDir) {
+			return t.fail("checkout", ErrNotExist)
+		}
+
+		var creds *state.Credentials
+		var err error
+		if m, creds, err = openEnv(t, &o); err != nil {
+			return err
+		}
+		log.Printf("Directory %s exists.\n\n", hostDir)
+
+		auth, err := o.gitAuth()
+		if err != nil {
+			return t.fail("fetch", err)
+		}
+		repo, err := git.Open(hostDir, auth)
+		if err != nil {
+			return t.fail("fetch", err)
+		}
+		if err = repo.Fetch(ctx); err != nil {
+			return t.fail("fetch", err)
+		}
+		// Force pushed branch or local changes stop update unless o.Force is set
+		if err = repo.Checkout(ctx, o.CommitSHA, o.Force); err != nil {
+			return t.fail("checkout", err)
+		}
+
+		if err = deploy(ctx, &o, cmd.WhenUpdate); err != nil {
+			return t.fail("deploy", err)
+		}
+		return finishEnv(ctx, t, &o, m, creds)
+	})
+	return m, err
+}
+
+// deploy run deploy steps of profile and log their summary
+func deploy(ctx context.Context, o *Options, when string) error {
+	results, err := cmd.RunSteps(ctx, o.hostDir(), when, config.DeploySteps(o.Conf, o.Profile))
+	cmd.PrintSteps(log.Writer(), results)
+	return err
+}
+
+// openEnv load manifest and database credentials of virtual host
+func openEnv(t *task, o *Options) (*state.Manifest, *state.Credentials, error) {
+	m, err := o.store().Open(o.RefSlug)
+	if err != nil {
+		return nil, nil, t.fail("state", err)
+	}
+	names, err := o.names(m)
+	if err != nil {
+		return nil, nil, t.fail("names", err)
+	}
+	m.Profile = o.Profile.Name
+	m.HostDir = o.hostDir()
+	m.DBName = names.Database
+	m.DBUser = names.User
+
+	// Database user password is generated once per virtual host
+	creds, err := o.credentials(t, names)
+	if err != nil {
+		return nil, nil, t.fail("credentials", err)
+	}
+	return m, creds, nil
+}
+
+// finishEnv run post-deploy steps of profile and save manifest
+func finishEnv(ctx context.Context, t *task, o *Options, m *state.Manifest, creds *state.Credentials) error {
+	if o.Profile.HasPostDeploy("bitrix-settings") {
+		if err := bitrixSettings(ctx, t, o, m, creds); err != nil {
+			return t.fail("bitrix-settings", err)
+		}
+	}
+
+	m.CommitSHA = o.CommitSHA
+	m.DeployedAt = state.Now()
+	if err := o.store().Save(m); err != nil {
+		return t.fail("state", err)
+	}
+	log.Printf("State of %s saved\n", o.RefSlug)
+	return nil
+}
+
+// bitrixSettings create Bitrix settings and database connection files from
+// examples and fill them by parse script
+func bitrixSettings(ctx context.Context, t *task, o *Options, m *state.Manifest, creds *state.Credentials) error {
+	bxConfDir := filepath.Join(m.HostDir, o.Conf.GetString("server.settings-dir"))
+	bxConnDir := filepath.Join(m.HostDir, o.Conf.GetString("server.dbconn-dir"))
+	settings := filepath.Join(bxConfDir, ".settings.php")
+	dbconn := filepath.Join(bxConnDir, "dbconn.php")
+	if cmd.DirectoryExists(settings) || cmd.DirectoryExists(dbconn) {
+		return nil
+	}
+
+	log.Println("Run parse settings...")
+	for _, file := range []string{settings, dbconn} {
+		file := file
+		t.Undo("remove "+file, func() error { return cmd.RemoveAll(file) })
+	}
+	if err := cmd.ExecContext(ctx, "", "cp", settings+".test-example", settings); err != nil {
+		return err
+	}
+	if err := cmd.ExecContext(ctx, "", "cp", dbconn+".test-example", dbconn); err != nil {
+		return err
+	}
+
+	// Password is passed in environment, arguments of process are readable
+	// by every local user
+	if !plan.Record(plan.Command, "DB_PASSWORD=*** php -f %s %s %s %s", o.Conf.GetString("server.parse"), m.HostDir, m.DBName, creds.User) {
+		parse := exec.CommandContext(ctx, "php", "-f", o.Conf.GetString("server.parse"), m.HostDir, m.DBName, creds.User)
+		parse.Env = append(os.Environ(), "DB_PASSWORD="+creds.Password)
+		if out, err := parse.CombinedOutput(); err != nil {
+			return fmt.Errorf("parse settings: %v\n%s", err, out)
+		}
+	}
+	m.SetConfig("bitrix-settings", settings)
+	m.SetConfig("bitrix-dbconn", dbconn)
+	log.Println("Parse complete.")
+	return nil
+}
+
+// Deploy create virtual host or update it, if directory exists
+func Deploy(ctx context.Context, o Options) (*state.Manifest, error) {
+	if o.Conf != nil && cmd.DirectoryExists(o.hostDir()) {
+		return Update(ctx, o)
+	}
+	return Create(ctx, o)
+}
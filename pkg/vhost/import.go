@@ -0,0 +1,234 @@
+package vhost
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/archive"
+	"github.com/antuspenskiy/automate-vhosts/pkg/cmd"
+	"github.com/antuspenskiy/automate-vhosts/pkg/db"
+	"github.com/antuspenskiy/automate-vhosts/pkg/plan"
+	"github.com/antuspenskiy/automate-vhosts/pkg/state"
+)
+
+// ImportDatabase copy dump from storage to local disk, recreate database and
+// user of virtual host, import dump and run post-import steps of profile.
+// Database and user are dropped if import or post-import step fails.
+func ImportDatabase(ctx context.Context, o Options) (*state.Manifest, error) {
+	t := &task{op: OpImport, refSlug: o.RefSlug}
+	var m *state.Manifest
+	err := t.run(&o, func() error {
+		// Database is not imported when it can't be anonymized
+		if o.Profile.HasPostImport("anonymize") && len(o.Profile.Anonymize) == 0 {
+			return t.fail("anonymize", fmt.Errorf("profile %s requests anonymize step without anonymize rules", o.Profile.Name))
+		}
+		var err error
+		if m, err = o.store().Open(o.RefSlug); err != nil {
+			return t.fail("state", err)
+		}
+		// Names are checked against existing databases before database is
+		// recreated, also names recorded by prepare without database
+		names, err := o.names(m)
+		if err != nil {
+			return t.fail("names", err)
+		}
+		dbName := names.Database
+
+		// Database user password is generated once per virtual host
+		creds, err := o.credentials(t, names)
+		if err != nil {
+			return t.fail("credentials", err)
+		}
+
+		dump := o.Dump
+		if dump == "" {
+			if dump, err = newestDump(o.Conf.GetString("storagedir")); err != nil {
+				return t.fail("dump", err)
+			}
+		}
+
+		// Copy database dump to local directory
+		if err = cmd.ExecContext(ctx, "", "rsync", "-P", "-t", dump, o.Conf.GetString("dbdir")); err != nil {
+			return t.fail("copy dump", err)
+		}
+		localDump := filepath.Join(o.Conf.GetString("dbdir"), filepath.Base(dump))
+		t.Undo("remove "+localDump, func() error { return cmd.RemoveAll(localDump) })
+
+		// Dump with several databases, like one of dump -all, is imported
+		// by entry, so they aren't merged into one database
+		entry, err := dumpEntry(localDump, o.DumpEntry)
+		if err != nil {
+			return t.fail("dump entry", err)
+		}
+
+		if err = prepareDatabase(t, &o, dbName, creds); err != nil {
+			return err
+		}
+		if err = importDump(ctx, &o, localDump, entry, dbName); err != nil {
+			return t.fail("import", err)
+		}
+
+		// Anonymize personal data by rules of profile
+		if o.Profile.HasPostImport("anonymize") {
+			results, err := db.Anonymize(o.DB, dbName, o.Profile.Anonymize)
+			for _, res := range results {
+				log.Printf("MySQL: Anonymize %s, %d rows affected\n", res.Rule, res.RowsAffected)
+			}
+			if err != nil {
+				return t.fail("anonymize", err)
+			}
+		}
+
+		// Delete database dump copy
+		if err = cmd.RemoveAll(localDump); err != nil {
+			return t.fail("remove dump", err)
+		}
+		log.Printf("File %s deleted. \n", localDump)
+
+		m.Profile = o.Profile.Name
+		m.DBName = dbName
+		m.DBUser = creds.User
+		m.ImportedAt = state.Now()
+		if err = o.store().Save(m); err != nil {
+			return t.fail("state", err)
+		}
+		log.Printf("State of %s saved\n", o.RefSlug)
+		return nil
+	})
+	return m, err
+}
+
+// newestDump returns the last dump of storage directory, dump names sort by
+// date. Files which are not dumps or archives, like partial rsync copies, are
+// skipped.
+func newestDump(dir string) (string, error) {
+	files, err := cmd.FilePathWalkDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var dumps []string
+	for _, file := range files {
+		if archive.IsDump(filepath.Base(file)) {
+			dumps = append(dumps, file)
+		}
+	}
+	if len(dumps) == 0 {
+		return "", ErrNoDump
+	}
+	sort.Strings(dumps)
+	return dumps[len(dumps)-1], nil
+}
+
+// prepareDatabase drop and create database, grant privileges to user
+func prepareDatabase(t *task, o *Options, dbName string, creds *state.Credentials) error {
+	numdrop, err := db.DropDB(o.DB, dbName)
+	if err != nil {
+		return t.fail("drop database", err)
+	}
+	log.Printf("MySQL: Running: DROP DATABASE IF EXISTS %s;\n", dbName)
+	log.Printf("MySQL: Query OK, %d rows affected\n\n", numdrop)
+
+	numcreate, err := db.CreateDB(o.DB, dbName)
+	if err != nil {
+		return t.fail("create database", err)
+	}
+	log.Printf("MySQL: Running: CREATE DATABASE %s CHARACTER SET utf8 collate utf8_unicode_ci;\n", dbName)
+	log.Printf("MySQL: Query OK, %d rows affected\n\n", numcreate)
+	// Partly imported or not anonymized database is dropped on failure
+	t.Undo("drop database "+dbName, func() error {
+		_, err := db.DropDB(o.DB, dbName)
+		return err
+	})
+
+	numgrant, err := db.GrantUserPriv(o.DB, dbName, creds.User, creds.Password)
+	if err != nil {
+		return t.fail("grant privileges", err)
+	}
+	log.Printf("MySQL: Running: GRANT ALL PRIVILEGES ON %s.* TO '%s'@'localhost' IDENTIFIED BY '***';\n", dbName, creds.User)
+	log.Printf("MySQL: Query OK, %d rows affected\n\n", numgrant)
+	t.Undo("drop user "+creds.User, func() error {
+		if _, err := db.DropUser(o.DB, creds.User); err != nil {
+			return err
+		}
+		_, err := db.FlushPriv(o.DB)
+		return err
+	})
+
+	numflush, err := db.FlushPriv(o.DB)
+	if err != nil {
+		return t.fail("flush privileges", err)
+	}
+	log.Printf("MySQL: Running: FLUSH PRIVILEGES;")
+	log.Printf("MySQL: Query OK, %d rows affected\n\n", numflush)
+	return nil
+}
+
+// dumpEntry returns .sql entry of dump to import: the only one, or the one
+// which name or base name, with or without .sql extension, is entry
+func dumpEntry(dump string, entry string) (string, error) {
+	// Dump isn't copied in dry-run mode
+	if plan.DryRun() {
+		return entry, nil
+	}
+	var found []string
+	err := archive.Walk(dump, func(e *archive.Entry, r io.Reader) error {
+		if e.Type != archive.TypeFile || filepath.Ext(e.Name) != ".sql" {
+			return nil
+		}
+		base := filepath.Base(e.Name)
+		if entry == "" || entry == e.Name || entry == base || entry+".sql" == base {
+			found = append(found, e.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case len(found) == 1:
+		return found[0], nil
+	case len(found) > 1:
+		return "", fmt.Errorf("%w: %s has %s, select one of them", ErrSeveralDumps, dump, strings.Join(found, ", "))
+	case entry != "":
+		return "", fmt.Errorf("%w: %s has no %s entry", ErrNoDump, dump, entry)
+	default:
+		return "", fmt.Errorf("%w: %s has no .sql entry", ErrNoDump, dump)
+	}
+}
+
+// importDump stream .sql entry of dump archive (.tar.gz, .tar.zst, .tar.xz,
+// .zip or .sql.gz) to database
+func importDump(ctx context.Context, o *Options, dump string, entry string, dbName string) error {
+	// Dump isn't copied in dry-run mode, import is only added to plan
+	if plan.Record(plan.SQL, "import .sql entry %s of %s into %s", entry, dump, dbName) {
+		return nil
+	}
+	started := time.Now()
+	err := archive.Walk(dump, func(e *archive.Entry, r io.Reader) error {
+		if e.Type != archive.TypeFile || e.Name != entry {
+			log.Printf("Skip archive entry %s\n", e.Name)
+			return nil
+		}
+		log.Printf("Import %s from %s to %s\n", e.Name, dump, dbName)
+		importer := &db.Importer{
+			DB:       o.DB,
+			Database: dbName,
+			Progress: func(p db.ImportProgress) {
+				log.Printf("Import %s: %d bytes, %d statements\n", e.Name, p.Bytes, p.Statements)
+			},
+		}
+		_, err := importer.Import(ctx, r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Import of %s finished in %s\n", dbName, time.Since(started))
+	return nil
+}
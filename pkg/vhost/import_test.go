@@ -0,0 +1,83 @@
+package vhost
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/archive"
+)
+
+// noConnector fails every connection, test fails if database is used
+type noConnector struct{}
+
+func (noConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, errors.New("database must not be used")
+}
+
+func (noConnector) Driver() driver.Driver { return nil }
+
+func TestImportDatabaseWithoutAnonymizeRules(t *testing.T) {
+	o := testOptions(t, "feature-a")
+	o.Profile.PostImport = []string{"anonymize"}
+	o.DB = sql.OpenDB(noConnector{})
+	defer o.DB.Close()
+
+	_, err := ImportDatabase(context.Background(), *o)
+	var vhostErr *Error
+	if !errors.As(err, &vhostErr) || vhostErr.Step != "anonymize" {
+		t.Errorf("ImportDatabase = %v, want error of anonymize step", err)
+	}
+}
+
+// writeDump write tar.gz dump with entries of names
+func writeDump(t *testing.T, names ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "dump_20260101.000000.tar.gz")
+	tw, err := archive.NewTarGzWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err = tw.WriteEntry(name, func(w io.Writer) error {
+			_, err := io.WriteString(w, "SELECT 1;\n")
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDumpEntry(t *testing.T) {
+	all := []string{"books.sql", "portal.sql", "README"}
+	tests := []struct {
+		name    string
+		entries []string
+		entry   string
+		want    string
+		wantErr error
+	}{
+		{name: "single database", entries: []string{"portal.sql", "README"}, want: "portal.sql"},
+		{name: "several databases", entries: all, wantErr: ErrSeveralDumps},
+		{name: "database name", entries: all, entry: "portal", want: "portal.sql"},
+		{name: "entry name", entries: all, entry: "books.sql", want: "books.sql"},
+		{name: "missing entry", entries: all, entry: "intranet", wantErr: ErrNoDump},
+		{name: "no .sql entry", entries: []string{"README"}, wantErr: ErrNoDump},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dumpEntry(writeDump(t, tt.entries...), tt.entry)
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("dumpEntry = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
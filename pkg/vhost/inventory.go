@@ -0,0 +1,256 @@
+package vhost
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/cmd"
+	"github.com/antuspenskiy/automate-vhosts/pkg/config"
+	"github.com/antuspenskiy/automate-vhosts/pkg/db"
+	"github.com/antuspenskiy/automate-vhosts/pkg/git"
+	"github.com/antuspenskiy/automate-vhosts/pkg/process"
+	"github.com/antuspenskiy/automate-vhosts/pkg/state"
+)
+
+// Status of virtual host collected from its directory, configuration files,
+// database, pm2 and state manifest
+type Status struct {
+	RefSlug string `json:"refslug"`
+	Profile string `json:"profile,omitempty"`
+	HostDir string `json:"host_dir"`
+	// Commit is checked out in virtual host directory
+	Commit string `json:"commit,omitempty"`
+	// Ports are read from php-fpm and pm2 configuration files
+	Ports map[string]int `json:"ports,omitempty"`
+	// NginxPorts are upstream ports of nginx configuration
+	NginxPorts map[string]int `json:"nginx_ports,omitempty"`
+	DBName     string         `json:"db_name,omitempty"`
+	// DBSize is -1 when database is not checked
+	DBSize int64 `json:"db_size"`
+	// PM2Status is status of pm2 process: online, stopped, errored, ...
+	PM2Status string `json:"pm2_status,omitempty"`
+	// PM2Restarts grows when pm2 process crash-loops
+	PM2Restarts int `json:"pm2_restarts,omitempty"`
+	// PM2Memory is resident memory of pm2 process in bytes
+	PM2Memory int64 `json:"pm2_memory,omitempty"`
+	// UnitStatus is status of systemd unit which runs node application
+	UnitStatus string     `json:"unit_status,omitempty"`
+	DiskUsage  int64      `json:"disk_usage"`
+	LastDeploy *time.Time `json:"last_deploy,omitempty"`
+	// Managed is true if virtual host has state manifest
+	Managed bool `json:"managed"`
+}
+
+// Inventory returns status of every virtual host, recorded in state store or
+// found in rootdir. Database size is checked only if o.DB is set.
+func Inventory(ctx context.Context, o Options) ([]*Status, error) {
+	manifests, err := o.store().List()
+	if err != nil {
+		return nil, err
+	}
+	folders, err := hostFolders(o.Conf.GetString("rootdir"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	byRefSlug := make(map[string]*state.Manifest)
+	for _, m := range manifests {
+		byRefSlug[m.RefSlug] = m
+	}
+	for _, folder := range folders {
+		if _, ok := byRefSlug[folder]; !ok {
+			byRefSlug[folder] = nil
+		}
+	}
+	refSlugs := make([]string, 0, len(byRefSlug))
+	for refSlug := range byRefSlug {
+		refSlugs = append(refSlugs, refSlug)
+	}
+	sort.Strings(refSlugs)
+
+	pm2 := pm2Processes(ctx)
+	list := make([]*Status, 0, len(refSlugs))
+	for _, refSlug := range refSlugs {
+		o.RefSlug = refSlug
+		list = append(list, inspect(ctx, &o, byRefSlug[refSlug], pm2))
+	}
+	return list, nil
+}
+
+// Inspect returns status of o.RefSlug virtual host
+func Inspect(ctx context.Context, o Options) (*Status, error) {
+	if err := ValidateRefSlug(o.RefSlug); err != nil {
+		return nil, &Error{Op: OpStatus, RefSlug: o.RefSlug, Step: "options", Err: err}
+	}
+	m, err := o.store().Load(o.RefSlug)
+	if os.IsNotExist(err) {
+		if !cmd.DirectoryExists(o.hostDir()) {
+			return nil, &Error{Op: OpStatus, RefSlug: o.RefSlug, Step: "state", Err: ErrNotExist}
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	return inspect(ctx, &o, m, pm2Processes(ctx)), nil
+}
+
+// inspect collect status of virtual host, m is nil for virtual hosts without
+// manifest. Failed checks are logged and leave their fields empty.
+func inspect(ctx context.Context, o *Options, m *state.Manifest, pm2 map[string]process.Process) *Status {
+	managed := m != nil
+	if !managed {
+		m = &state.Manifest{RefSlug: o.RefSlug, HostDir: o.hostDir()}
+		if n, err := o.resolveNames(m); err != nil {
+			log.Printf("Names of %s: %v\n", o.RefSlug, err)
+		} else {
+			m.DBName = n.Database
+		}
+		m.SetConfig("nginx", filepath.Join(o.Conf.GetString("nginxdir"), o.RefSlug+".conf"))
+		m.SetConfig("fpm", filepath.Join(o.Conf.GetString("fpmdir"), o.RefSlug+".conf"))
+		m.SetConfig("pm2", filepath.Join(o.Conf.GetString("server.pm2"), o.RefSlug+".json"))
+		m.PM2App = o.RefSlug
+		if unit := config.UnitPath(o.Conf, o.RefSlug); cmd.DirectoryExists(unit) {
+			m.SetConfig("systemd", unit)
+			m.Unit = config.UnitName(o.RefSlug)
+		}
+	}
+	s := &Status{
+		RefSlug:    m.RefSlug,
+		Profile:    m.Profile,
+		HostDir:    m.HostDir,
+		Commit:     m.CommitSHA,
+		DBName:     m.DBName,
+		DBSize:     -1,
+		LastDeploy: m.DeployedAt,
+		Managed:    managed,
+	}
+
+	// Commit checked out right now, manifest keeps commit of the last deploy
+	if repo, err := git.Open(m.HostDir, nil); err == nil {
+		if head, err := repo.Head(); err == nil {
+			s.Commit = head
+		}
+	}
+
+	if path, ok := m.Configs["fpm"]; ok && cmd.DirectoryExists(path) {
+		if port, err := config.FpmListenPort(path); err == nil {
+			s.setPort(config.PortPhp, port)
+		}
+	}
+	if path, ok := m.Configs["pm2"]; ok && cmd.DirectoryExists(path) {
+		if port, err := config.PM2Port(path); err == nil {
+			s.setPort(config.PortNode, port)
+		}
+	}
+	if path, ok := m.Configs["systemd"]; ok && cmd.DirectoryExists(path) {
+		if port, err := config.SystemdPort(path); err == nil {
+			s.setPort(config.PortNode, port)
+		}
+	}
+	if path, ok := m.Configs["nginx"]; ok && cmd.DirectoryExists(path) {
+		if ports, err := config.NginxPorts(path); err == nil && len(ports) > 0 {
+			s.NginxPorts = ports
+		}
+	}
+
+	if o.DB != nil && m.DBName != "" {
+		size, err := db.DatabaseSize(o.DB, m.DBName)
+		if err != nil {
+			log.Printf("Size of database %s: %v\n", m.DBName, err)
+		} else {
+			s.DBSize = size
+		}
+	}
+
+	if p, ok := pm2[m.PM2App]; ok && m.PM2App != "" {
+		s.PM2Status = p.Status
+		s.PM2Restarts = p.Restarts
+		s.PM2Memory = p.Memory
+	}
+	if m.Unit != "" {
+		if status, err := cmd.Services().Status(ctx, m.Unit); err == nil {
+			s.UnitStatus = status
+		}
+	}
+
+	if size, err := diskUsage(m.HostDir); err == nil {
+		s.DiskUsage = size
+	}
+	return s
+}
+
+func (s *Status) setPort(service string, port int) {
+	if s.Ports == nil {
+		s.Ports = make(map[string]int)
+	}
+	s.Ports[service] = port
+}
+
+// pm2Processes returns pm2 processes by name, empty map if pm2 is not available
+func pm2Processes(ctx context.Context) map[string]process.Process {
+	byName := make(map[string]process.Process)
+	processes, err := process.NewPM2().List(ctx)
+	if err != nil {
+		log.Printf("%v\n", err)
+		return byName
+	}
+	for _, p := range processes {
+		byName[p.Name] = p
+	}
+	return byName
+}
+
+// diskUsage returns size of files in directory, symlinks are not followed
+func diskUsage(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// hostFolders returns directories of rootdir which are virtual hosts,
+// directories of logs, pm2 configuration, main site and default host are skipped.
+// Directories which names aren't refslugs are skipped and logged.
+func hostFolders(rootDir string) ([]string, error) {
+	files, err := ioutil.ReadDir(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	var folders []string
+	for _, f := range files {
+		if !f.IsDir() || skipFolder(f.Name()) {
+			continue
+		}
+		if err = ValidateRefSlug(f.Name()); err != nil {
+			log.Printf("Skip directory %s of rootdir: %v\n", f.Name(), err)
+			continue
+		}
+		folders = append(folders, f.Name())
+	}
+	return folders, nil
+}
+
+// reservedFolders of rootdir are not virtual hosts, they are matched exactly,
+// so "feature-login" or "blog-fix" are virtual hosts
+var reservedFolders = map[string]bool{
+	"pm2json":  true,
+	"log":      true,
+	"logs":     true,
+	"intranet": true,
+	"default":  true,
+}
+
+func skipFolder(name string) bool {
+	return reservedFolders[name]
+}
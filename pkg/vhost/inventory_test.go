@@ -0,0 +1,57 @@
+package vhost
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/cmd"
+	"github.com/antuspenskiy/automate-vhosts/pkg/state"
+)
+
+func TestHostFolders(t *testing.T) {
+	root := t.TempDir()
+	dirs := []string{
+		"pm2json", "log", "logs", "intranet", "default",
+		"feature-login", "blog-fix", "default-theme", "intranet-2", "logs-cleanup", "master",
+		// Not refslugs
+		"Feature_X", "my.site", "-lead", "lost+found",
+	}
+	for _, dir := range dirs {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "feature-file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	folders, err := hostFolders(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"blog-fix", "default-theme", "feature-login", "intranet-2", "logs-cleanup", "master"}
+	if !reflect.DeepEqual(folders, want) {
+		t.Errorf("hostFolders = %q, want %q", folders, want)
+	}
+}
+
+func TestInspectUnitStatus(t *testing.T) {
+	fake := &cmd.Fake{Active: map[string]bool{"av-feature-a.service": true}}
+	prev := cmd.Services()
+	cmd.SetServiceManager(fake)
+	defer cmd.SetServiceManager(prev)
+
+	o := testOptions(t, "feature-a")
+	m := &state.Manifest{RefSlug: "feature-a", HostDir: o.hostDir(), Unit: "av-feature-a.service"}
+	if s := inspect(context.Background(), o, m, nil); s.UnitStatus != cmd.StatusActive {
+		t.Errorf("unit status = %q, want %q", s.UnitStatus, cmd.StatusActive)
+	}
+	m.Unit = "av-feature-b.service"
+	if s := inspect(context.Background(), o, m, nil); s.UnitStatus != cmd.StatusInactive {
+		t.Errorf("unit status = %q, want %q", s.UnitStatus, cmd.StatusInactive)
+	}
+}
@@ -0,0 +1,122 @@
+package vhost
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/cmd"
+	"github.com/antuspenskiy/automate-vhosts/pkg/db"
+	"github.com/antuspenskiy/automate-vhosts/pkg/state"
+)
+
+// resolveNames returns database and user names of virtual host: names
+// recorded in manifest, legacy names of virtual host created before manifests
+// or new names derived from refslug. Every operation names database and user
+// by it.
+func (o *Options) resolveNames(m *state.Manifest) (db.Names, error) {
+	if m.DBName != "" {
+		// Manifests written before user names were recorded have user
+		// named as database
+		n := db.Names{Database: m.DBName, User: m.DBUser}
+		if n.User == "" {
+			n.User = n.Database
+		}
+		return n, nil
+	}
+	legacy, err := o.legacy()
+	if err != nil {
+		return db.Names{}, err
+	}
+	if legacy {
+		name := db.ParseBranchName(o.RefSlug)
+		return db.Names{Database: name, User: name}, nil
+	}
+	return db.DeriveNames(o.RefSlug), nil
+}
+
+// legacy returns true if virtual host without recorded names was created
+// before manifests: its directory or database of legacy name exists. Database
+// is checked only if o.DB is set.
+func (o *Options) legacy() (bool, error) {
+	if cmd.DirectoryExists(o.hostDir()) {
+		return true, nil
+	}
+	if o.DB == nil {
+		return false, nil
+	}
+	return db.DatabaseExists(o.DB, db.ParseBranchName(o.RefSlug))
+}
+
+// names returns database and user names of virtual host checked by
+// checkNames
+func (o *Options) names(m *state.Manifest) (db.Names, error) {
+	n, err := o.resolveNames(m)
+	if err != nil {
+		return n, err
+	}
+	if err = o.checkNames(m, n); err != nil {
+		return n, err
+	}
+	log.Printf("Database of %s: %s, user: %s\n", o.RefSlug, n.Database, n.User)
+	return n, nil
+}
+
+// checkNames returns ErrNameCollision if names are used by another virtual
+// host: they are recorded in its manifest or, if o.DB is set, database exists
+// and it is neither imported by this virtual host nor its legacy database
+func (o *Options) checkNames(m *state.Manifest, n db.Names) error {
+	manifests, err := o.store().List()
+	if err != nil {
+		return err
+	}
+	for _, other := range manifests {
+		if other.RefSlug == o.RefSlug {
+			continue
+		}
+		if other.DBName == n.Database || other.DBUser == n.User {
+			return fmt.Errorf("%w: %s and %s of %s are used by %s", db.ErrNameCollision, n.Database, n.User, o.RefSlug, other.RefSlug)
+		}
+	}
+
+	if o.DB == nil || m.ImportedAt != nil || n.Database == db.ParseBranchName(o.RefSlug) {
+		return nil
+	}
+	exists, err := db.DatabaseExists(o.DB, n.Database)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%w: database %s of %s exists", db.ErrNameCollision, n.Database, o.RefSlug)
+	}
+	return nil
+}
+
+// credentials returns credentials of database user of virtual host. Virtual
+// host created before credentials were stored, its directory or MySQL user
+// exists, keeps legacy password: its legacy database name. Credentials file
+// created by task is removed on rollback.
+func (o *Options) credentials(t *task, n db.Names) (*state.Credentials, error) {
+	legacyPassword := ""
+	_, err := o.store().LoadCredentials(o.RefSlug)
+	created := os.IsNotExist(err)
+	if created && n.User == db.ParseBranchName(o.RefSlug) {
+		existed := cmd.DirectoryExists(o.hostDir())
+		if !existed && o.DB != nil {
+			if existed, err = db.UserExists(o.DB, n.User); err != nil {
+				return nil, err
+			}
+		}
+		if existed {
+			legacyPassword = n.Database
+		}
+	}
+	creds, err := o.store().Credentials(o.RefSlug, n.User, legacyPassword)
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		t.Undo("remove credentials of "+o.RefSlug, func() error { return o.store().RemoveCredentials(o.RefSlug) })
+	}
+	return creds, nil
+}
@@ -0,0 +1,42 @@
+package vhost
+
+import (
+	"os"
+	"testing"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/db"
+)
+
+func TestCredentialsRollback(t *testing.T) {
+	o := testOptions(t, "feature-a")
+	names := db.Names{Database: "feature_a", User: "feature_a"}
+
+	// Credentials created by failed task are removed
+	tk := &task{op: OpCreate, refSlug: o.RefSlug}
+	if _, err := o.credentials(tk, names); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tk.undo.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.store().LoadCredentials(o.RefSlug); !os.IsNotExist(err) {
+		t.Errorf("LoadCredentials after rollback = %v, want not exist", err)
+	}
+
+	// Stored credentials are kept
+	created, err := o.credentials(&task{op: OpCreate, refSlug: o.RefSlug}, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk = &task{op: OpUpdate, refSlug: o.RefSlug}
+	if _, err = o.credentials(tk, names); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tk.undo.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := o.store().LoadCredentials(o.RefSlug)
+	if err != nil || *stored != *created {
+		t.Errorf("credentials after rollback = %+v, %v, want %+v", stored, err, created)
+	}
+}
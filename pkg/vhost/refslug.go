@@ -0,0 +1,57 @@
+package vhost
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// refSlugPattern is format of GitLab CI_COMMIT_REF_SLUG: lowercased branch
+	// name shortened to 63 bytes, everything except 0-9 and a-z replaced with
+	// "-", without leading and trailing "-"
+	refSlugPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+	// commitPattern is full or abbreviated commit hash, CI_COMMIT_SHA
+	commitPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+)
+
+var (
+	// ErrInvalidRefSlug is returned for refslug which is not CI_COMMIT_REF_SLUG
+	ErrInvalidRefSlug = errors.New("refslug doesn't match CI_COMMIT_REF_SLUG format")
+	// ErrInvalidCommit is returned for commit which is not a hash
+	ErrInvalidCommit = errors.New("commit is not a hash")
+)
+
+// ValidateRefSlug returns ErrInvalidRefSlug if refslug doesn't match
+// CI_COMMIT_REF_SLUG format. Refslug names directories, configuration files,
+// databases and processes, so it is checked before any work is done.
+func ValidateRefSlug(refSlug string) error {
+	if !refSlugPattern.MatchString(refSlug) {
+		return fmt.Errorf("%w: %q", ErrInvalidRefSlug, refSlug)
+	}
+	return nil
+}
+
+// RefSlug returns CI_COMMIT_REF_SLUG of branch, like task-feature for
+// Task/Feature
+func RefSlug(branch string) string {
+	slug := []byte(strings.ToLower(branch))
+	for i, c := range slug {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			slug[i] = '-'
+		}
+	}
+	if len(slug) > 63 {
+		slug = slug[:63]
+	}
+	return strings.Trim(string(slug), "-")
+}
+
+// ValidateCommit returns ErrInvalidCommit if commit is not a hash
+func ValidateCommit(commit string) error {
+	if !commitPattern.MatchString(commit) {
+		return fmt.Errorf("%w: %q", ErrInvalidCommit, commit)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package vhost
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateRefSlug(t *testing.T) {
+	tests := []struct {
+		refSlug string
+		valid   bool
+	}{
+		{"master", true},
+		{"feature-login", true},
+		{"1", true},
+		{"task-123-fix", true},
+		{strings.Repeat("a", 63), true},
+		{strings.Repeat("a", 64), false},
+		{"", false},
+		{"-feature", false},
+		{"feature-", false},
+		{"Feature", false},
+		{"feature_login", false},
+		{"feature.login", false},
+		{"../etc", false},
+		{"a/b", false},
+		{"a;rm -rf", false},
+		{"a b", false},
+	}
+	for _, tt := range tests {
+		err := ValidateRefSlug(tt.refSlug)
+		if tt.valid && err != nil {
+			t.Errorf("ValidateRefSlug(%q) = %v, want nil", tt.refSlug, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidRefSlug) {
+			t.Errorf("ValidateRefSlug(%q) = %v, want ErrInvalidRefSlug", tt.refSlug, err)
+		}
+	}
+}
+
+func TestRefSlug(t *testing.T) {
+	tests := []struct {
+		branch string
+		want   string
+	}{
+		{"master", "master"},
+		{"Task/Feature", "task-feature"},
+		{"feature_login", "feature-login"},
+		{"release/1.2.3", "release-1-2-3"},
+		{"/feature/", "feature"},
+		{strings.Repeat("b", 70), strings.Repeat("b", 63)},
+		{strings.Repeat("c", 62) + "/d", strings.Repeat("c", 62)},
+	}
+	for _, tt := range tests {
+		got := RefSlug(tt.branch)
+		if got != tt.want {
+			t.Errorf("RefSlug(%q) = %q, want %q", tt.branch, got, tt.want)
+		}
+		if err := ValidateRefSlug(got); err != nil {
+			t.Errorf("RefSlug(%q) = %q is not valid: %v", tt.branch, got, err)
+		}
+	}
+}
+
+func TestValidateCommit(t *testing.T) {
+	tests := []struct {
+		commit string
+		valid  bool
+	}{
+		{"27ec806", true},
+		{"27ec806e1d8f4a7b2c9d0e1f2a3b4c5d6e7f8a9b", true},
+		{"27ec80", false},
+		{"27EC806", false},
+		{"HEAD", false},
+		{"master", false},
+		{"27ec806 --force", false},
+	}
+	for _, tt := range tests {
+		err := ValidateCommit(tt.commit)
+		if tt.valid != (err == nil) {
+			t.Errorf("ValidateCommit(%q) = %v, want valid %v", tt.commit, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package vhost
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/cmd"
+	"github.com/antuspenskiy/automate-vhosts/pkg/config"
+	"github.com/antuspenskiy/automate-vhosts/pkg/db"
+	"github.com/antuspenskiy/automate-vhosts/pkg/git"
+	"github.com/antuspenskiy/automate-vhosts/pkg/process"
+	"github.com/antuspenskiy/automate-vhosts/pkg/state"
+)
+
+// Remove drop database and user of virtual host, delete pm2 process, virtual
+// host directory and configuration files, free its ports and forget its state.
+// Virtual hosts without manifest are removed by directory conventions.
+// Removal can't be rolled back, it stops on the first failed step.
+func Remove(ctx context.Context, o Options) error {
+	t := &task{op: OpRemove, refSlug: o.RefSlug}
+	return t.run(&o, func() error {
+		m, err := o.store().Load(o.RefSlug)
+		if os.IsNotExist(err) {
+			m, err = legacyManifest(&o)
+		}
+		if err != nil {
+			return t.fail("state", err)
+		}
+
+		// Delete MySQL database
+		if m.DBName != "" {
+			numdrop, err := db.DropDB(o.DB, m.DBName)
+			if err != nil {
+				return t.fail("drop database", err)
+			}
+			log.Printf("MySQL: Running: DROP DATABASE IF EXISTS %s;\n", m.DBName)
+			log.Printf("MySQL: Query OK, %d rows affected\n\n", numdrop)
+		}
+
+		if m.DBUser != "" {
+			numdropuser, err := db.DropUser(o.DB, m.DBUser)
+			if err != nil {
+				return t.fail("drop user", err)
+			}
+			log.Printf("MySQL: Running: DROP USER IF EXISTS '%s'@'localhost';\n", m.DBUser)
+			log.Printf("MySQL: Query OK, %d rows affected\n\n", numdropuser)
+
+			numflush, err := db.FlushPriv(o.DB)
+			if err != nil {
+				return t.fail("flush privileges", err)
+			}
+			log.Printf("MySQL: Running: FLUSH PRIVILEGES;")
+			log.Printf("MySQL: Query OK, %d rows affected\n\n", numflush)
+		}
+
+		// Remove pm2 process for virtual host
+		if m.PM2App != "" {
+			if err = process.NewPM2().Delete(ctx, m.PM2App); err != nil {
+				return t.fail("pm2", err)
+			}
+		}
+
+		// Stop systemd unit of node application, it is unloaded after unit
+		// file is removed
+		if m.Unit != "" {
+			if err = config.StopUnit(ctx, m.Unit); err != nil {
+				return t.fail("systemd", err)
+			}
+		}
+
+		// Remove virtual host directory, then nginx, php-fpm and pm2
+		// configuration files, files inside virtual host directory are
+		// already deleted
+		if m.HostDir != "" {
+			if err = cmd.RemoveAll(m.HostDir); err != nil {
+				return t.fail("remove directory", err)
+			}
+		}
+		for name, confFile := range m.Configs {
+			if err = cmd.RemoveAll(confFile); err != nil {
+				return t.fail("remove configuration", err)
+			}
+			if service := config.ArtifactService(name); service != "" {
+				t.changes.MarkChanged(service)
+			}
+		}
+		if m.Unit != "" {
+			if err = cmd.ExecContext(ctx, "", "systemctl", "daemon-reload"); err != nil {
+				return t.fail("systemd", err)
+			}
+		}
+
+		// Free ports of virtual host
+		ports, err := config.OpenPortRegistryFromConfig(o.Conf)
+		if err != nil {
+			return t.fail("ports", err)
+		}
+		defer ports.Close()
+		ports.Release(o.RefSlug)
+		if err = ports.Save(); err != nil {
+			return t.fail("ports", err)
+		}
+
+		if err = o.store().RemoveCredentials(o.RefSlug); err != nil {
+			return t.fail("credentials", err)
+		}
+		if err = o.store().Remove(o.RefSlug); err != nil {
+			return t.fail("state", err)
+		}
+		return nil
+	})
+}
+
+// legacyManifest returns manifest by directory conventions, for virtual hosts
+// created before state store
+func legacyManifest(o *Options) (*state.Manifest, error) {
+	m := &state.Manifest{RefSlug: o.RefSlug, HostDir: o.hostDir()}
+	n, err := o.resolveNames(m)
+	if err != nil {
+		return nil, err
+	}
+	m.DBName = n.Database
+	m.DBUser = n.User
+	m.SetConfig("nginx", filepath.Join(o.Conf.GetString("nginxdir"), o.RefSlug+".conf"))
+	m.SetConfig("fpm", filepath.Join(o.Conf.GetString("fpmdir"), o.RefSlug+".conf"))
+	if o.Profile.HasArtifact("pm2") {
+		m.SetConfig("pm2", filepath.Join(o.Conf.GetString("server.pm2"), o.RefSlug+".json"))
+		m.PM2App = o.RefSlug
+	}
+	if o.Profile.HasArtifact("systemd") {
+		m.SetConfig("systemd", config.UnitPath(o.Conf, o.RefSlug))
+		m.Unit = config.UnitName(o.RefSlug)
+	}
+	return m, nil
+}
+
+// Stale returns virtual hosts which branches are deleted from remote
+// repository. Remote branches are listed from repository of o.RefSlug virtual
+// host, virtual hosts are manifests of state store and folders of rootdir.
+func Stale(ctx context.Context, o Options) ([]string, error) {
+	if err := ValidateRefSlug(o.RefSlug); err != nil {
+		return nil, err
+	}
+	branches, err := remoteBranches(ctx, &o, o.hostDir())
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("\nRemote Branches:\n\n%s\n\n", strings.Join(branches, "\n"))
+
+	// List folders
+	folders, err := hostFolders(o.Conf.GetString("rootdir"))
+	if err != nil {
+		return nil, fmt.Errorf("list folders: %v", err)
+	}
+	fmt.Printf("Branches Folders:\n\n%s\n\n", strings.Join(folders, "\n"))
+
+	// Virtual hosts recorded in state store, folders without state are
+	// created before state store
+	manifests, err := o.store().List()
+	if err != nil {
+		return nil, err
+	}
+	vhosts := make([]string, 0)
+	for _, m := range manifests {
+		vhosts = append(vhosts, m.RefSlug)
+	}
+	vhosts = append(vhosts, cmd.Difference(folders, vhosts)...)
+
+	return cmd.Difference(vhosts, branches), nil
+}
+
+// remoteBranches returns refslugs of branches of origin repository of dir
+func remoteBranches(ctx context.Context, o *Options, dir string) ([]string, error) {
+	auth, err := o.gitAuth()
+	if err != nil {
+		return nil, err
+	}
+	repo, err := git.Open(dir, auth)
+	if err != nil {
+		return nil, err
+	}
+	branches, err := repo.RemoteBranches(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list remote branches: %v", err)
+	}
+	refSlugs := make([]string, 0, len(branches))
+	for _, branch := range branches {
+		refSlugs = append(refSlugs, RefSlug(branch))
+	}
+	return refSlugs, nil
+}
@@ -0,0 +1,199 @@
+package vhost
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/antuspenskiy/automate-vhosts/pkg/cmd"
+	"github.com/antuspenskiy/automate-vhosts/pkg/config"
+	"github.com/antuspenskiy/automate-vhosts/pkg/git"
+	"github.com/antuspenskiy/automate-vhosts/pkg/state"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/spf13/viper"
+)
+
+// Operations of virtual host, Error.Op is one of them
+const (
+	OpCreate    = "create"
+	OpUpdate    = "update"
+	OpConfigure = "configure"
+	OpImport    = "import"
+	OpRemove    = "remove"
+	OpStatus    = "status"
+)
+
+var (
+	// ErrExists is returned by Create when virtual host directory exists
+	ErrExists = errors.New("virtual host directory exists")
+	// ErrNotExist is returned by Update when virtual host directory doesn't exist
+	ErrNotExist = errors.New("virtual host directory doesn't exist")
+	// ErrNoDump is returned by ImportDatabase when storage has no dumps
+	ErrNoDump = errors.New("no database dump in storage")
+	// ErrSeveralDumps is returned by ImportDatabase when dump has several
+	// .sql entries and DumpEntry doesn't select one of them
+	ErrSeveralDumps = errors.New("dump has several databases")
+)
+
+// Error is a failed step of virtual host operation. Steps done before the
+// failure are rolled back, RollbackErr is set if rollback failed too.
+type Error struct {
+	Op          string
+	RefSlug     string
+	Step        string
+	Err         error
+	RollbackErr error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s %s: %s: %v", e.Op, e.RefSlug, e.Step, e.Err)
+	if e.RollbackErr != nil {
+		msg += fmt.Sprintf(" (%v)", e.RollbackErr)
+	}
+	return msg
+}
+
+// Unwrap returns error of failed step
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Options of virtual host operations
+type Options struct {
+	// RefSlug is a branch slug, it names virtual host directory and configuration files
+	RefSlug string
+	// CommitSHA is checked out by Create and Update
+	CommitSHA string
+	// Force let Update hard reset directory with local changes or to commit
+	// which is not a descendant of checked out one, like after force push
+	Force bool
+	// Profile of project, see config.SelectProfile
+	Profile *config.Profile
+	// Conf is env.json configuration
+	Conf *viper.Viper
+	// Store keeps manifests and credentials, statedir of Conf is used if nil
+	Store *state.Store
+	// DB is a MySQL connection with privileges to create databases and users,
+	// used by ImportDatabase and Remove
+	DB *sql.DB
+	// Dump is imported by ImportDatabase, the newest dump of storagedir if empty
+	Dump string
+	// DumpEntry is .sql entry of Dump imported by ImportDatabase, like
+	// "portal" of dump with several databases. Dump must have one .sql entry
+	// if it is empty.
+	DumpEntry string
+	// Changes records services which configuration is changed by operation,
+	// caller reloads them with Changes.Reload, like after several Remove. If
+	// nil, operation reloads its services itself at the end.
+	Changes *cmd.ChangeSet
+}
+
+func (o *Options) validate(op string) error {
+	if o.RefSlug == "" {
+		return errors.New("refslug is empty")
+	}
+	if err := ValidateRefSlug(o.RefSlug); err != nil {
+		return err
+	}
+	if (op == OpCreate || op == OpUpdate) && o.CommitSHA != "" {
+		if err := ValidateCommit(o.CommitSHA); err != nil {
+			return err
+		}
+	}
+	if o.Conf == nil {
+		return errors.New("configuration is not set")
+	}
+	if o.Profile == nil {
+		return errors.New("profile is not set")
+	}
+	if (op == OpImport || op == OpRemove) && o.DB == nil {
+		return errors.New("database connection is not set")
+	}
+	return nil
+}
+
+func (o *Options) store() *state.Store {
+	if o.Store == nil {
+		o.Store = config.OpenState(o.Conf)
+	}
+	return o.Store
+}
+
+// gitAuth returns authentication by "server.git-key" private key, ssh agent
+// is used if it is not set
+func (o *Options) gitAuth() (transport.AuthMethod, error) {
+	return git.Auth(o.Conf.GetString("server.git-key"))
+}
+
+func (o *Options) hostDir() string {
+	return filepath.Join(o.Conf.GetString("rootdir"), o.RefSlug)
+}
+
+// task run steps of one operation, undo actions and changed services belong
+// to the operation
+type task struct {
+	op      string
+	refSlug string
+	undo    cmd.UndoLog
+	changes *cmd.ChangeSet
+}
+
+// Undo register action which reverts a step of operation
+func (t *task) Undo(name string, fn func() error) {
+	t.undo.Undo(name, fn)
+}
+
+// fail returns error of failed step
+func (t *task) fail(step string, err error) error {
+	return &Error{Op: t.op, RefSlug: t.refSlug, Step: step, Err: err}
+}
+
+// run execute operation with lock of virtual host state, steps registered
+// with Undo are rolled back if it fails and forgotten if it succeeds. Changed
+// services are reloaded at the end, also after rollback, unless o.Changes is
+// set by caller.
+func (t *task) run(o *Options, fn func() error) error {
+	if err := o.validate(t.op); err != nil {
+		return t.fail("options", err)
+	}
+	lock, err := o.store().Lock(t.refSlug)
+	if err != nil {
+		return t.fail("lock", err)
+	}
+	defer lock.Unlock()
+
+	t.changes = o.Changes
+	if t.changes == nil {
+		t.changes = cmd.NewChangeSet()
+	}
+	err = t.finish(fn())
+	if o.Changes == nil {
+		// Rolled back files are applied by reload too
+		if rerr := t.changes.Reload(context.Background()); err == nil && rerr != nil {
+			err = t.fail("reload", rerr)
+		} else if rerr != nil {
+			log.Printf("%v\n", rerr)
+		}
+	}
+	return err
+}
+
+// finish forget undo actions if operation succeeded, roll them back if it
+// failed
+func (t *task) finish(err error) error {
+	if err == nil {
+		t.undo.Commit()
+		return nil
+	}
+
+	_, rollbackErr := t.undo.Rollback()
+	e, ok := err.(*Error)
+	if !ok {
+		e = t.fail("unknown", err).(*Error)
+	}
+	e.RollbackErr = rollbackErr
+	return e
+}